@@ -0,0 +1,286 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	"github.com/nats-io/nats.go/jetstream"
+
+	. "github.com/openfga/go-sdk/client"
+)
+
+// accessEventsMaxAge is how long the access change events are kept in their
+// stream.
+const accessEventsMaxAge = 7 * 24 * time.Hour
+
+var (
+	// accessEventsPublished counts the access change events published.
+	accessEventsPublished *expvar.Int
+	// accessEventsFailed counts the access change events that could not be
+	// published.
+	accessEventsFailed *expvar.Int
+	// userNotificationsPublished counts the user access notifications
+	// published.
+	userNotificationsPublished *expvar.Int
+	// userNotificationsFailed counts the user access notifications that could
+	// not be published.
+	userNotificationsFailed *expvar.Int
+)
+
+func init() {
+	accessEventsPublished = expvar.NewInt("access_events_published")
+	accessEventsFailed = expvar.NewInt("access_events_failed")
+	userNotificationsPublished = expvar.NewInt("user_notifications_published")
+	userNotificationsFailed = expvar.NewInt("user_notifications_failed")
+}
+
+// accessTuple is a relation of a user to the object of an access change event.
+type accessTuple struct {
+	User     string `json:"user"`
+	Relation string `json:"relation"`
+}
+
+// accessChangeEvent is the event published when the relationships of an
+// object changed.
+type accessChangeEvent struct {
+	Object     string        `json:"object"`
+	ObjectType string        `json:"object_type"`
+	Added      []accessTuple `json:"added"`
+	Removed    []accessTuple `json:"removed"`
+	// Users are the users whose direct access to the object changed. Users
+	// with access through a group or the public wildcard are not listed.
+	Users     []string  `json:"users"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// accessChangeEvents groups written and deleted tuples into an event per
+// object, in the order the objects first appear.
+func accessChangeEvents(
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+	changedAt time.Time,
+) []*accessChangeEvent {
+	var events []*accessChangeEvent
+	byObject := map[string]*accessChangeEvent{}
+	eventOf := func(object string) *accessChangeEvent {
+		event, ok := byObject[object]
+		if !ok {
+			objectType, _, _ := strings.Cut(object, ":")
+			event = &accessChangeEvent{
+				Object:     object,
+				ObjectType: objectType,
+				Added:      []accessTuple{},
+				Removed:    []accessTuple{},
+				Users:      []string{},
+				ChangedAt:  changedAt,
+			}
+			byObject[object] = event
+			events = append(events, event)
+		}
+		return event
+	}
+	addUser := func(event *accessChangeEvent, user string) {
+		if strings.HasPrefix(user, "user:") && user != "user:*" && !slices.Contains(event.Users, user) {
+			event.Users = append(event.Users, user)
+		}
+	}
+
+	for _, tuple := range writes {
+		event := eventOf(tuple.Object)
+		event.Added = append(event.Added, accessTuple{User: tuple.User, Relation: tuple.Relation})
+		addUser(event, tuple.User)
+	}
+	for _, tuple := range deletes {
+		event := eventOf(tuple.Object)
+		event.Removed = append(event.Removed, accessTuple{User: tuple.User, Relation: tuple.Relation})
+		addUser(event, tuple.User)
+	}
+	return events
+}
+
+// userNotification is the access change notification of a user: a line per
+// granted or revoked relation, in the format of the access check replies, e.g.
+// "project:1#writer@user:alice\ttrue".
+type userNotification struct {
+	User string
+	Data []byte
+}
+
+// userNotifications groups written and deleted tuples of users into a
+// notification per user, in the order the users first appear. The public
+// wildcard and group principals are left out.
+func userNotifications(writes []ClientTupleKey, deletes []ClientTupleKeyWithoutCondition) []*userNotification {
+	var notifications []*userNotification
+	byUser := map[string]*userNotification{}
+	add := func(user, relation, object string, granted bool) {
+		if !strings.HasPrefix(user, "user:") || user == "user:*" {
+			return
+		}
+		notification, ok := byUser[user]
+		if !ok {
+			notification = &userNotification{User: user}
+			byUser[user] = notification
+			notifications = append(notifications, notification)
+		}
+		notification.Data = fmt.Appendf(notification.Data, "%s#%s@%s\t%t\n", object, relation, user, granted)
+	}
+
+	for _, tuple := range writes {
+		add(tuple.User, tuple.Relation, tuple.Object, true)
+	}
+	for _, tuple := range deletes {
+		add(tuple.User, tuple.Relation, tuple.Object, false)
+	}
+	return notifications
+}
+
+// userSubject returns the access change subject of a user. Characters that are
+// not allowed in a subject token, such as dots, are percent-encoded, so that
+// "user:john.doe" is notified on "lfx.access_changed.user.john%2Edoe".
+func userSubject(user string) string {
+	id := strings.TrimPrefix(user, "user:")
+	var token strings.Builder
+	for i := range len(id) {
+		c := id[i]
+		switch {
+		case c == '.' || c == '*' || c == '>' || c == '%' || c <= ' ' || c >= 0x7f:
+			fmt.Fprintf(&token, "%%%02X", c)
+		default:
+			token.WriteByte(c)
+		}
+	}
+	return constants.AccessChangedUserSubjectPrefix + token.String()
+}
+
+// accessEventPublisher publishes the access change events to their stream.
+type accessEventPublisher struct {
+	publisher IJetStreamPublisher
+	// outbox records the access changes until they are published, if set.
+	outbox IOutboxBucket
+}
+
+// createAccessEventPublisher creates or updates the stream of the access
+// change events, and the outbox bucket of the access changes waiting to be
+// published.
+func createAccessEventPublisher(ctx context.Context) (*accessEventPublisher, error) {
+	name := os.Getenv("ACCESS_CHANGED_STREAM")
+	if name == "" {
+		name = constants.AccessChangedStreamName
+	}
+
+	_, err := jetstreamConn.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        name,
+		Description: "FGA sync access change events",
+		Subjects:    []string{constants.AccessChangedSubjects},
+		Retention:   jetstream.LimitsPolicy,
+		Storage:     jetstream.FileStorage,
+		MaxAge:      accessEventsMaxAge,
+	})
+	if err != nil {
+		logger.With(errKey, err, "stream", name).Error("error creating access change stream")
+		return nil, err
+	}
+	logger.With("stream", name).Info("access change stream ready")
+
+	bucket := os.Getenv("ACCESS_OUTBOX_BUCKET")
+	if bucket == "" {
+		bucket = constants.AccessOutboxBucketName
+	}
+
+	// A change that could not be published for as long as the events are kept
+	// expires.
+	outbox, err := jetstreamConn.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "FGA sync access changes waiting to be published",
+		Storage:     jetstream.FileStorage,
+		TTL:         accessEventsMaxAge,
+	})
+	if err != nil {
+		logger.With(errKey, err, "bucket", bucket).Error("error creating access outbox bucket")
+		return nil, err
+	}
+	logger.With("bucket", bucket).Info("access outbox bucket ready")
+
+	return &accessEventPublisher{publisher: jetstreamConn, outbox: outbox}, nil
+}
+
+// accessMessage is a message published for an access change: the event of an
+// object or the notification of a user.
+type accessMessage struct {
+	subject      string
+	data         []byte
+	notification bool
+}
+
+// accessMessages returns the event of each object whose relationships were
+// changed by the given writes and deletes, followed by the notification of each
+// user who was granted or revoked a relation.
+func accessMessages(
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+	changedAt time.Time,
+) []accessMessage {
+	var messages []accessMessage
+	for _, event := range accessChangeEvents(writes, deletes, changedAt) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			accessEventsFailed.Add(1)
+			logger.With(errKey, err, "object", event.Object).Error("error encoding access change event")
+			continue
+		}
+		messages = append(messages, accessMessage{
+			subject: constants.AccessChangedObjectSubjectPrefix + event.ObjectType,
+			data:    data,
+		})
+	}
+	for _, notification := range userNotifications(writes, deletes) {
+		messages = append(messages, accessMessage{
+			subject:      userSubject(notification.User),
+			data:         notification.Data,
+			notification: true,
+		})
+	}
+	return messages
+}
+
+// publish publishes the access change of the given writes and deletes without
+// recording it in the outbox. The tuples are already written, so a failed
+// publication is logged and counted rather than failing the sync.
+func (p *accessEventPublisher) publish(
+	ctx context.Context,
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+) {
+	if p == nil {
+		return
+	}
+	for _, message := range accessMessages(writes, deletes, time.Now().UTC()) {
+		p.send(ctx, message)
+	}
+}
+
+// send publishes a message to the stream, and reports whether it succeeded.
+func (p *accessEventPublisher) send(ctx context.Context, message accessMessage, opts ...jetstream.PublishOpt) bool {
+	published, failed := accessEventsPublished, accessEventsFailed
+	if message.notification {
+		published, failed = userNotificationsPublished, userNotificationsFailed
+	}
+	// The tuples were written even if the sync was canceled since.
+	if _, err := p.publisher.Publish(context.WithoutCancel(ctx), message.subject, message.data, opts...); err != nil {
+		failed.Add(1)
+		logger.With(errKey, err, "subject", message.subject).ErrorContext(ctx, "error publishing access change")
+		return false
+	}
+	published.Add(1)
+	return true
+}
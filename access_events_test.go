@@ -0,0 +1,172 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestAccessChangeEvents tests the accessChangeEvents function
+func TestAccessChangeEvents(t *testing.T) {
+	changedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	writes := []ClientTupleKey{
+		{User: "user:alice", Relation: "writer", Object: "project:1"},
+		{User: "user:*", Relation: "viewer", Object: "project:1"},
+		{User: "project:1", Relation: "project", Object: "meeting:2"},
+	}
+	deletes := []ClientTupleKeyWithoutCondition{
+		{User: "user:alice", Relation: "viewer", Object: "project:1"},
+		{User: "user:bob", Relation: "participant", Object: "meeting:2"},
+	}
+
+	events := accessChangeEvents(writes, deletes, changedAt)
+
+	assert.Equal(t, []*accessChangeEvent{
+		{
+			Object:     "project:1",
+			ObjectType: "project",
+			Added:      []accessTuple{{User: "user:alice", Relation: "writer"}, {User: "user:*", Relation: "viewer"}},
+			Removed:    []accessTuple{{User: "user:alice", Relation: "viewer"}},
+			Users:      []string{"user:alice"},
+			ChangedAt:  changedAt,
+		},
+		{
+			Object:     "meeting:2",
+			ObjectType: "meeting",
+			Added:      []accessTuple{{User: "project:1", Relation: "project"}},
+			Removed:    []accessTuple{{User: "user:bob", Relation: "participant"}},
+			Users:      []string{"user:bob"},
+			ChangedAt:  changedAt,
+		},
+	}, events)
+	assert.Empty(t, accessChangeEvents(nil, nil, changedAt))
+}
+
+// TestUserNotifications tests the userNotifications function
+func TestUserNotifications(t *testing.T) {
+	notifications := userNotifications([]ClientTupleKey{
+		{User: "user:alice", Relation: "writer", Object: "project:1"},
+		{User: "user:*", Relation: "viewer", Object: "project:1"},
+		{User: "team:2#member", Relation: "viewer", Object: "project:1"},
+		{User: "user:bob", Relation: "host", Object: "meeting:3"},
+	}, []ClientTupleKeyWithoutCondition{
+		{User: "user:alice", Relation: "viewer", Object: "project:1"},
+	})
+
+	assert.Equal(t, []*userNotification{
+		{User: "user:alice", Data: []byte("project:1#writer@user:alice\ttrue\nproject:1#viewer@user:alice\tfalse\n")},
+		{User: "user:bob", Data: []byte("meeting:3#host@user:bob\ttrue\n")},
+	}, notifications)
+}
+
+// TestUserSubject tests the userSubject function
+func TestUserSubject(t *testing.T) {
+	tests := []struct {
+		user string
+		want string
+	}{
+		{user: "user:alice", want: "lfx.access_changed.user.alice"},
+		{user: "user:john.doe", want: "lfx.access_changed.user.john%2Edoe"},
+		{user: "user:a b*>%", want: "lfx.access_changed.user.a%20b%2A%3E%25"},
+		{user: "user:auth0|123@example.org", want: "lfx.access_changed.user.auth0|123@example%2Eorg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			assert.Equal(t, tt.want, userSubject(tt.user))
+		})
+	}
+}
+
+// TestAccessEventPublisher tests the publication of access change events
+func TestAccessEventPublisher(t *testing.T) {
+	publisher := &MockJetStreamPublisher{}
+	events := &accessEventPublisher{publisher: publisher}
+
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.object.project", mock.MatchedBy(func(data []byte) bool {
+		var event accessChangeEvent
+		return json.Unmarshal(data, &event) == nil &&
+			event.Object == "project:1" &&
+			len(event.Added) == 1 &&
+			len(event.Removed) == 0 &&
+			event.Users[0] == "user:alice"
+	})).Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.object.committee", mock.Anything).
+		Return((*jetstream.PubAck)(nil), errors.New("no responders")).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.user.alice", []byte("project:1#writer@user:alice\ttrue\n")).
+		Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.user.bob", []byte("committee:3#member@user:bob\tfalse\n")).
+		Return(&jetstream.PubAck{}, nil).Once()
+
+	failed := accessEventsFailed.Value()
+	events.publish(context.Background(), []ClientTupleKey{
+		{User: "user:alice", Relation: "writer", Object: "project:1"},
+	}, []ClientTupleKeyWithoutCondition{
+		{User: "user:bob", Relation: "member", Object: "committee:3"},
+	})
+
+	publisher.AssertExpectations(t)
+	assert.Equal(t, failed+1, accessEventsFailed.Value())
+
+	// Publishing is disabled without a publisher.
+	(*accessEventPublisher)(nil).publish(context.Background(), []ClientTupleKey{{Object: "project:1"}}, nil)
+}
+
+// TestWriteAndDeleteTuplesEvents tests that access change events are published
+// for the applied transactions only.
+func TestWriteAndDeleteTuplesEvents(t *testing.T) {
+	writes := make([]ClientTupleKey, 150)
+	for i := range writes {
+		writes[i] = ClientTupleKey{User: "user:u" + strconv.Itoa(i), Relation: "viewer", Object: "project:1"}
+	}
+	userSubjects := mock.MatchedBy(func(subject string) bool {
+		return strings.HasPrefix(subject, "lfx.access_changed.user.")
+	})
+	applied := func(count int) any {
+		return mock.MatchedBy(func(data []byte) bool {
+			var event accessChangeEvent
+			return json.Unmarshal(data, &event) == nil && len(event.Added) == count
+		})
+	}
+
+	mockClient := &MockFgaClient{}
+	publisher := &MockJetStreamPublisher{}
+	fgaService := FgaService{
+		client:      mockClient,
+		cacheBucket: NewMockKeyValue(),
+		events:      &accessEventPublisher{publisher: publisher},
+	}
+
+	// The first transaction is applied before the second fails.
+	mockClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Once()
+	mockClient.On("Write", mock.Anything, mock.Anything).Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.object.project", applied(100)).
+		Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, userSubjects, mock.Anything).Return(&jetstream.PubAck{}, nil).Times(100)
+	assert.Error(t, fgaService.WriteAndDeleteTuples(context.Background(), writes, nil))
+
+	mockClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Twice()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.object.project", applied(150)).
+		Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, userSubjects, mock.Anything).Return(&jetstream.PubAck{}, nil).Times(150)
+	assert.NoError(t, fgaService.WriteAndDeleteTuples(context.Background(), writes, nil))
+
+	// Nothing is published when nothing was applied.
+	mockClient.On("Write", mock.Anything, mock.Anything).Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+	assert.Error(t, fgaService.WriteAndDeleteTuples(context.Background(), writes[:10], nil))
+
+	mockClient.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
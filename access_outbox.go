@@ -0,0 +1,292 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	openfga "github.com/openfga/go-sdk"
+
+	. "github.com/openfga/go-sdk/client"
+)
+
+const (
+	// outboxRelayInterval is how often the relay looks for the access changes
+	// left in the outbox.
+	outboxRelayInterval = 10 * time.Second
+	// outboxRetryDelay is how long after its last attempt the relay publishes
+	// a committed access change again.
+	outboxRetryDelay = 30 * time.Second
+	// outboxPendingTimeout is how long after being recorded an access change
+	// that was never committed is recovered by the relay, unless twice the
+	// update timeout is longer, so that the sync that recorded it has ended.
+	outboxPendingTimeout = 2 * time.Minute
+)
+
+var (
+	// accessOutboxRelayed counts the access changes published by the relay.
+	accessOutboxRelayed *expvar.Int
+	// accessOutboxRecovered counts the pending access changes recovered by the
+	// relay.
+	accessOutboxRecovered *expvar.Int
+)
+
+func init() {
+	accessOutboxRelayed = expvar.NewInt("access_outbox_relayed")
+	accessOutboxRecovered = expvar.NewInt("access_outbox_recovered")
+}
+
+// IOutboxBucket is the part of a NATS KV bucket needed for the access outbox.
+type IOutboxBucket interface {
+	Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error)
+	Create(ctx context.Context, key string, value []byte, opts ...jetstream.KVCreateOpt) (uint64, error)
+	Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error)
+	Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error
+	ListKeys(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyLister, error)
+}
+
+// outboxEntry is an access change recorded in the outbox. It is recorded as
+// pending before its tuples are written to OpenFGA, committed with the tuples
+// that were applied, and removed once all its messages are published.
+type outboxEntry struct {
+	// Writes and Deletes are the tuples to write, and once committed, the
+	// tuples that were applied.
+	Writes  []ClientTupleKey                 `json:"writes,omitempty"`
+	Deletes []ClientTupleKeyWithoutCondition `json:"deletes,omitempty"`
+	// Committed is set once the tuples were written.
+	Committed bool `json:"committed"`
+	// Delivered is the number of messages of the change already published.
+	Delivered int       `json:"delivered,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+
+	key      string
+	revision uint64
+}
+
+// record records the access change of the given writes and deletes as pending
+// in the outbox, before they are written. It returns nil without an outbox.
+func (p *accessEventPublisher) record(
+	ctx context.Context,
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+) (*outboxEntry, error) {
+	if p == nil || p.outbox == nil {
+		return nil, nil
+	}
+	key := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + nuid.Next()
+	entry := &outboxEntry{Writes: writes, Deletes: deletes, key: key}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.revision, err = p.outbox.Create(ctx, entry.key, data); err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "error recording access change")
+		return nil, err
+	}
+	return entry, nil
+}
+
+// commit records that the given tuples of a change were applied, and publishes
+// the change. Without an outbox entry, the change is published directly. The
+// tuples are already written, so failures are left to the relay rather than
+// failing the sync.
+func (p *accessEventPublisher) commit(
+	ctx context.Context,
+	entry *outboxEntry,
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+) {
+	if p == nil {
+		return
+	}
+	if entry == nil {
+		if len(writes) > 0 || len(deletes) > 0 {
+			p.publish(ctx, writes, deletes)
+		}
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if len(writes) == 0 && len(deletes) == 0 {
+		p.remove(ctx, entry)
+		return
+	}
+	entry.Writes, entry.Deletes, entry.Committed = writes, deletes, true
+	if entry.ChangedAt.IsZero() {
+		entry.ChangedAt = time.Now().UTC()
+	}
+	// If the change cannot be committed, the relay recovers it once it has
+	// been pending for long enough.
+	if p.save(ctx, entry) {
+		p.deliver(ctx, entry)
+	}
+}
+
+// deliver publishes the messages of a committed change that were not yet
+// published, in order, and removes the change from the outbox once they all
+// were. Each message has an ID, so that the stream drops it if it is published
+// again within its duplicate window. It reports whether all the messages were
+// published.
+func (p *accessEventPublisher) deliver(ctx context.Context, entry *outboxEntry) bool {
+	messages := accessMessages(entry.Writes, entry.Deletes, entry.ChangedAt)
+	for entry.Delivered < len(messages) {
+		msgID := entry.key + "." + strconv.Itoa(entry.Delivered)
+		if !p.send(ctx, messages[entry.Delivered], jetstream.WithMsgID(msgID)) {
+			// Keep the progress for the relay.
+			p.save(ctx, entry)
+			return false
+		}
+		entry.Delivered++
+	}
+	p.remove(ctx, entry)
+	return true
+}
+
+// load reads a change from the outbox, and returns when it was last updated.
+func (p *accessEventPublisher) load(ctx context.Context, key string) (*outboxEntry, time.Time, error) {
+	kvEntry, err := p.outbox.Get(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	entry := &outboxEntry{key: key, revision: kvEntry.Revision()}
+	if err = json.Unmarshal(kvEntry.Value(), entry); err != nil {
+		return nil, time.Time{}, err
+	}
+	return entry, kvEntry.Created(), nil
+}
+
+// save updates a change in the outbox, unless it was updated since it was
+// read, e.g. by the relay of another instance. It reports whether it succeeded.
+func (p *accessEventPublisher) save(ctx context.Context, entry *outboxEntry) bool {
+	data, err := json.Marshal(entry)
+	if err == nil {
+		entry.revision, err = p.outbox.Update(ctx, entry.key, data, entry.revision)
+	}
+	if err != nil {
+		logger.With(errKey, err, "key", entry.key).ErrorContext(ctx, "error updating access change")
+		return false
+	}
+	return true
+}
+
+// remove removes a change from the outbox.
+func (p *accessEventPublisher) remove(ctx context.Context, entry *outboxEntry) {
+	if err := p.outbox.Delete(ctx, entry.key); err != nil {
+		logger.With(errKey, err, "key", entry.key).ErrorContext(ctx, "error removing access change")
+	}
+}
+
+// relayAccessChanges periodically publishes the access changes left in the
+// outbox, until the context is canceled.
+func (s FgaService) relayAccessChanges(ctx context.Context) {
+	if s.events == nil || s.events.outbox == nil {
+		return
+	}
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.relayOutbox(ctx, now)
+		}
+	}
+}
+
+// relayOutbox publishes the committed changes whose publication failed, and
+// recovers the changes left pending by a sync that ended before committing
+// them, e.g. because the service stopped after writing the tuples.
+func (s FgaService) relayOutbox(ctx context.Context, now time.Time) {
+	lister, err := s.events.outbox.ListKeys(ctx)
+	if err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "error listing access changes")
+		return
+	}
+	var keys []string
+	for key := range lister.Keys() {
+		keys = append(keys, key)
+	}
+	// Keys start with the time the change was recorded at, so older changes
+	// are published first.
+	slices.Sort(keys)
+
+	pendingTimeout := max(outboxPendingTimeout, 2*updateTimeout)
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		entry, updatedAt, err := s.events.load(ctx, key)
+		if err != nil {
+			logger.With(errKey, err, "key", key).WarnContext(ctx, "error reading access change")
+			continue
+		}
+		switch age := now.Sub(updatedAt); {
+		case entry.Committed && age >= outboxRetryDelay:
+			if s.events.deliver(ctx, entry) {
+				accessOutboxRelayed.Add(1)
+			}
+		case !entry.Committed && age >= pendingTimeout:
+			if err := s.recoverAccessChange(ctx, entry, updatedAt); err != nil {
+				logger.With(errKey, err, "key", key).WarnContext(ctx, "error recovering access change")
+			}
+		}
+	}
+}
+
+// recoverAccessChange commits a pending change with its tuples that are found
+// applied in OpenFGA: the writes that exist and the deletes that do not.
+func (s FgaService) recoverAccessChange(ctx context.Context, entry *outboxEntry, recordedAt time.Time) error {
+	var writes []ClientTupleKey
+	for _, tuple := range entry.Writes {
+		exists, err := s.tupleExists(ctx, tuple.User, tuple.Relation, tuple.Object)
+		if err != nil {
+			return err
+		}
+		if exists {
+			writes = append(writes, tuple)
+		}
+	}
+	var deletes []ClientTupleKeyWithoutCondition
+	for _, tuple := range entry.Deletes {
+		exists, err := s.tupleExists(ctx, tuple.User, tuple.Relation, tuple.Object)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			deletes = append(deletes, tuple)
+		}
+	}
+
+	logger.With(
+		"key", entry.key,
+		"writes_count", len(writes),
+		"deletes_count", len(deletes),
+	).InfoContext(ctx, "recovered pending access change")
+	accessOutboxRecovered.Add(1)
+
+	entry.ChangedAt = recordedAt.UTC()
+	s.events.commit(ctx, entry, writes, deletes)
+	return nil
+}
+
+// tupleExists reports whether a tuple is stored in OpenFGA.
+func (s FgaService) tupleExists(ctx context.Context, user, relation, object string) (bool, error) {
+	resp, err := s.client.Read(ctx, ClientReadRequest{
+		User:     openfga.PtrString(user),
+		Relation: openfga.PtrString(relation),
+		Object:   openfga.PtrString(object),
+	}, ClientReadOptions{})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Tuples) > 0, nil
+}
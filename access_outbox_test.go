@@ -0,0 +1,199 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// setupOutboxService returns a service publishing its access changes through
+// an outbox.
+func setupOutboxService() (FgaService, *MockFgaClient, *MockJetStreamPublisher, *MockKeyValue) {
+	mockClient := &MockFgaClient{}
+	publisher := &MockJetStreamPublisher{}
+	outbox := NewMockKeyValue()
+	return FgaService{
+		client:      mockClient,
+		cacheBucket: NewMockKeyValue(),
+		events:      &accessEventPublisher{publisher: publisher, outbox: outbox},
+	}, mockClient, publisher, outbox
+}
+
+// outboxEntryOf reads an access change from the mock outbox.
+func outboxEntryOf(t *testing.T, outbox *MockKeyValue, key string) outboxEntry {
+	t.Helper()
+	var entry outboxEntry
+	kvEntry, err := outbox.Get(context.Background(), key)
+	if assert.NoError(t, err) {
+		assert.NoError(t, json.Unmarshal(kvEntry.Value(), &entry))
+	}
+	return entry
+}
+
+// TestWriteAndDeleteTuplesOutbox tests that access changes are recorded in the
+// outbox before the tuples are written, and removed once published.
+func TestWriteAndDeleteTuplesOutbox(t *testing.T) {
+	writes := []ClientTupleKey{{User: "user:alice", Relation: "writer", Object: "project:1"}}
+	deletes := []ClientTupleKeyWithoutCondition{{User: "user:bob", Relation: "writer", Object: "project:1"}}
+
+	t.Run("published", func(t *testing.T) {
+		service, mockClient, publisher, outbox := setupOutboxService()
+		mockClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Run(func(mock.Arguments) {
+			keys := outbox.Keys()
+			if !assert.Len(t, keys, 1) {
+				return
+			}
+			entry := outboxEntryOf(t, outbox, keys[0])
+			assert.False(t, entry.Committed)
+			assert.Equal(t, writes, entry.Writes)
+			assert.Equal(t, deletes, entry.Deletes)
+		}).Once()
+		publisher.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(&jetstream.PubAck{}, nil).Times(3)
+
+		assert.NoError(t, service.WriteAndDeleteTuples(context.Background(), writes, deletes))
+		assert.Empty(t, outbox.Keys())
+		mockClient.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("publish failed", func(t *testing.T) {
+		service, mockClient, publisher, outbox := setupOutboxService()
+		mockClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Once()
+		publisher.On("Publish", mock.Anything, "lfx.access_changed.object.project", mock.Anything).
+			Return(&jetstream.PubAck{}, nil).Once()
+		publisher.On("Publish", mock.Anything, "lfx.access_changed.user.alice", mock.Anything).
+			Return((*jetstream.PubAck)(nil), errors.New("no responders")).Once()
+
+		assert.NoError(t, service.WriteAndDeleteTuples(context.Background(), writes, deletes))
+		keys := outbox.Keys()
+		if !assert.Len(t, keys, 1) {
+			return
+		}
+		entry := outboxEntryOf(t, outbox, keys[0])
+		assert.True(t, entry.Committed)
+		assert.Equal(t, 1, entry.Delivered)
+
+		// The relay leaves the change to its last attempt for a while.
+		service.relayOutbox(context.Background(), time.Now())
+		publisher.AssertExpectations(t)
+
+		// It then publishes the messages that were not published yet.
+		publisher.On("Publish", mock.Anything, "lfx.access_changed.user.alice", mock.Anything).
+			Return(&jetstream.PubAck{}, nil).Once()
+		publisher.On("Publish", mock.Anything, "lfx.access_changed.user.bob", mock.Anything).
+			Return(&jetstream.PubAck{}, nil).Once()
+		relayed := accessOutboxRelayed.Value()
+		service.relayOutbox(context.Background(), time.Now().Add(outboxRetryDelay))
+
+		assert.Empty(t, outbox.Keys())
+		assert.Equal(t, relayed+1, accessOutboxRelayed.Value())
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		service, mockClient, publisher, outbox := setupOutboxService()
+		mockClient.On("Write", mock.Anything, mock.Anything).
+			Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+
+		assert.Error(t, service.WriteAndDeleteTuples(context.Background(), writes, deletes))
+		assert.Empty(t, outbox.Keys())
+		publisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("outbox unavailable", func(t *testing.T) {
+		service, mockClient, _, outbox := setupOutboxService()
+		outbox.SetError(errors.New("timeout"))
+
+		assert.Error(t, service.WriteAndDeleteTuples(context.Background(), writes, deletes))
+		mockClient.AssertNotCalled(t, "Write", mock.Anything, mock.Anything)
+	})
+}
+
+// TestRelayOutboxRecovery tests that the relay publishes the applied tuples of
+// an access change left pending, e.g. by a crash after the tuples were written.
+func TestRelayOutboxRecovery(t *testing.T) {
+	service, mockClient, publisher, outbox := setupOutboxService()
+	ctx := context.Background()
+
+	entry, err := service.events.record(ctx, []ClientTupleKey{
+		{User: "user:alice", Relation: "writer", Object: "project:1"},
+		{User: "user:carol", Relation: "writer", Object: "project:1"},
+	}, []ClientTupleKeyWithoutCondition{
+		{User: "user:bob", Relation: "writer", Object: "project:1"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	recordedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	outbox.SetCreated(entry.key, recordedAt)
+
+	// The change is left to the sync that recorded it for a while.
+	service.relayOutbox(ctx, recordedAt.Add(time.Minute))
+	mockClient.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything)
+
+	readUser := func(user string) any {
+		return mock.MatchedBy(func(req ClientReadRequest) bool {
+			return *req.User == user && *req.Relation == "writer" && *req.Object == "project:1"
+		})
+	}
+	// Only alice was written and bob deleted before the crash.
+	mockClient.On("Read", mock.Anything, readUser("user:alice"), mock.Anything).
+		Return(&ClientReadResponse{Tuples: []openfga.Tuple{{}}}, nil).Once()
+	mockClient.On("Read", mock.Anything, readUser("user:carol"), mock.Anything).
+		Return(&ClientReadResponse{}, nil).Once()
+	mockClient.On("Read", mock.Anything, readUser("user:bob"), mock.Anything).
+		Return(&ClientReadResponse{}, nil).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.object.project", mock.MatchedBy(func(data []byte) bool {
+		var event accessChangeEvent
+		return json.Unmarshal(data, &event) == nil &&
+			assert.ObjectsAreEqual([]string{"user:alice", "user:bob"}, event.Users) &&
+			event.ChangedAt.Equal(recordedAt)
+	})).Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.user.alice", mock.Anything).
+		Return(&jetstream.PubAck{}, nil).Once()
+	publisher.On("Publish", mock.Anything, "lfx.access_changed.user.bob", mock.Anything).
+		Return(&jetstream.PubAck{}, nil).Once()
+
+	recovered := accessOutboxRecovered.Value()
+	service.relayOutbox(ctx, recordedAt.Add(outboxPendingTimeout))
+
+	assert.Empty(t, outbox.Keys())
+	assert.Equal(t, recovered+1, accessOutboxRecovered.Value())
+	mockClient.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
+
+// TestRelayOutboxRecoveryUnavailable tests that a pending access change is
+// kept while OpenFGA cannot be read.
+func TestRelayOutboxRecoveryUnavailable(t *testing.T) {
+	service, mockClient, _, outbox := setupOutboxService()
+	ctx := context.Background()
+
+	entry, err := service.events.record(ctx, []ClientTupleKey{
+		{User: "user:alice", Relation: "writer", Object: "project:1"},
+	}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	recordedAt := time.Now().Add(-outboxPendingTimeout)
+	outbox.SetCreated(entry.key, recordedAt)
+
+	mockClient.On("Read", mock.Anything, mock.Anything, mock.Anything).
+		Return((*ClientReadResponse)(nil), errors.New("connection refused")).Once()
+	service.relayOutbox(ctx, time.Now())
+
+	assert.Equal(t, []string{entry.key}, outbox.Keys())
+	assert.False(t, outboxEntryOf(t, outbox, entry.key).Committed)
+	mockClient.AssertExpectations(t)
+}
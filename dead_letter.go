@@ -0,0 +1,519 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// deadLetterMaxAge is how long dead-lettered messages are kept.
+	deadLetterMaxAge = 14 * 24 * time.Hour
+	// deadLetterAppliedMaxAge is how long the applied updates superseding dead
+	// letters are kept: longer than the dead letters, so that a dead letter is
+	// never replayed over an update whose mark expired first.
+	deadLetterAppliedMaxAge = deadLetterMaxAge + 24*time.Hour
+	// deadLetterListLimit is the default and maximum number of dead letters in
+	// a list reply.
+	deadLetterListLimit = 100
+)
+
+// errCodeNotFound is returned by the dead-letter admin subjects when the
+// dead letter does not exist.
+const errCodeNotFound = "not_found"
+
+// deadLetters is the dead-letter queue of the failed update and delete
+// messages. Failures are only logged while it is nil.
+var deadLetters *deadLetterQueue
+
+// IDeadLetterStream is the part of a JetStream stream needed to read and
+// delete dead letters.
+type IDeadLetterStream interface {
+	GetMsg(ctx context.Context, seq uint64, opts ...jetstream.GetMsgOpt) (*jetstream.RawStreamMsg, error)
+	DeleteMsg(ctx context.Context, seq uint64) error
+}
+
+// IJetStreamPublisher is the part of a JetStream client needed to publish dead
+// letters.
+type IJetStreamPublisher interface {
+	Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// deadLetterQueue stores the messages that failed to be handled in a
+// JetStream stream, from which they can be inspected and replayed.
+type deadLetterQueue struct {
+	stream    IDeadLetterStream
+	publisher IJetStreamPublisher
+	// applied holds when an update or deletion of an object was last applied,
+	// so that the dead letters it superseded are not replayed automatically.
+	// It is only set when dead letters are replayed automatically, without
+	// JetStream, and nothing is recorded while it is nil.
+	applied INatsKeyValue
+	// replay publishes a message again to its original subject.
+	replay func(ctx context.Context, msg *nats.Msg) error
+}
+
+// objectError is a handler error with the object the message was about, which
+// is stored in the dead letter of the message.
+type objectError struct {
+	object string
+	err    error
+}
+
+// Error implements [error].
+func (e *objectError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *objectError) Unwrap() error {
+	return e.err
+}
+
+// deadLetter is the envelope of a dead-lettered message.
+type deadLetter struct {
+	// Sequence is the stream sequence of the dead letter, set when it is read.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Subject is the subject the message was received on.
+	Subject string `json:"subject"`
+	// Data is the original message payload.
+	Data []byte `json:"data,omitempty"`
+	// Header is the original message headers, such as its request ID, trace
+	// context and dry-run header, which are restored when it is replayed.
+	Header nats.Header `json:"header,omitempty"`
+	// Object is the object the message was about, when it was parsed.
+	Object string `json:"object,omitempty"`
+	// Error is the error of the last attempt.
+	Error replyError `json:"error"`
+	// Attempts is the number of times the message was handled.
+	Attempts uint64 `json:"attempts"`
+	// ReceivedAt is when the message was first received.
+	ReceivedAt time.Time `json:"received_at"`
+	// FailedAt is when the message was dead-lettered.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// deadLetterRequest is the payload of the dead-letter admin subjects.
+type deadLetterRequest struct {
+	// Sequence is the dead letter to get or replay.
+	Sequence uint64 `json:"sequence"`
+	// After lists the dead letters after this sequence.
+	After uint64 `json:"after"`
+	// Limit is the maximum number of dead letters listed.
+	Limit int `json:"limit"`
+}
+
+// deadLetterReply is the reply of the dead-letter admin subjects.
+type deadLetterReply struct {
+	DeadLetters []deadLetter `json:"dead_letters,omitempty"`
+	DeadLetter  *deadLetter  `json:"dead_letter,omitempty"`
+	// Next is the sequence to list after to get the next page, if there may be
+	// more dead letters.
+	Next     uint64      `json:"next,omitempty"`
+	Replayed bool        `json:"replayed,omitempty"`
+	Error    *replyError `json:"error,omitempty"`
+}
+
+// createDeadLetterQueue creates or updates the dead-letter stream, and without
+// JetStream the bucket of the applied updates superseding dead letters.
+func createDeadLetterQueue(ctx context.Context) (*deadLetterQueue, error) {
+	name := os.Getenv("DEAD_LETTER_STREAM")
+	if name == "" {
+		name = constants.DeadLetterStreamName
+	}
+
+	stream, err := jetstreamConn.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        name,
+		Description: "FGA sync update and delete requests that failed",
+		Subjects:    []string{constants.DeadLetterSubject},
+		Retention:   jetstream.LimitsPolicy,
+		Storage:     jetstream.FileStorage,
+		MaxAge:      deadLetterMaxAge,
+	})
+	if err != nil {
+		logger.With(errKey, err, "stream", name).Error("error creating dead-letter stream")
+		return nil, err
+	}
+	logger.With("stream", name).Info("dead-letter stream ready")
+
+	// With JetStream, failed updates are kept in the stream instead of being
+	// replayed automatically, so no applied updates are recorded.
+	var applied INatsKeyValue
+	if !useJetStream {
+		bucket := os.Getenv("DEAD_LETTER_APPLIED_BUCKET")
+		if bucket == "" {
+			bucket = constants.DeadLetterAppliedBucketName
+		}
+		applied, err = jetstreamConn.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "FGA sync updates superseding dead letters",
+			Storage:     jetstream.FileStorage,
+			TTL:         deadLetterAppliedMaxAge,
+		})
+		if err != nil {
+			logger.With(errKey, err, "bucket", bucket).Error("error creating dead-letter applied bucket")
+			return nil, err
+		}
+		logger.With("bucket", bucket).Info("dead-letter applied bucket ready")
+	}
+
+	return &deadLetterQueue{
+		stream:    stream,
+		publisher: jetstreamConn,
+		applied:   applied,
+		replay: func(ctx context.Context, msg *nats.Msg) error {
+			// Replays of stream subjects are stored in the stream, so that they
+			// are retried like the original message.
+			if useJetStream && isSyncSubject(msg.Subject) {
+				_, err := jetstreamConn.PublishMsg(ctx, msg)
+				return err
+			}
+			return natsConn.PublishMsg(msg)
+		},
+	}, nil
+}
+
+// add dead-letters a message that failed to be handled.
+func (q *deadLetterQueue) add(
+	ctx context.Context,
+	subject string,
+	data []byte,
+	header nats.Header,
+	errHandler error,
+	attempts uint64,
+	receivedAt time.Time,
+) error {
+	if q == nil {
+		return nil
+	}
+
+	var errObject *objectError
+	errors.As(errHandler, &errObject)
+	letter, err := json.Marshal(deadLetter{
+		Subject:    subject,
+		Data:       data,
+		Header:     replayHeader(header),
+		Object:     errObject.objectOrEmpty(),
+		Error:      replyError{Code: errorCode(errHandler), Message: errHandler.Error()},
+		Attempts:   attempts,
+		ReceivedAt: receivedAt.UTC(),
+		FailedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ack, err := q.publisher.Publish(ctx, constants.DeadLetterSubject, letter)
+	if err != nil {
+		logger.With(errKey, err, "subject", subject).ErrorContext(ctx, "error dead-lettering message")
+		return err
+	}
+	logger.With(
+		"subject", subject,
+		"sequence", ack.Sequence,
+		"attempts", attempts,
+		"error_code", errorCode(errHandler),
+	).WarnContext(ctx, "message dead-lettered")
+
+	return nil
+}
+
+// get reads a dead letter.
+func (q *deadLetterQueue) get(ctx context.Context, seq uint64, opts ...jetstream.GetMsgOpt) (*deadLetter, error) {
+	msg, err := q.stream.GetMsg(ctx, seq, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	letter := new(deadLetter)
+	if err = json.Unmarshal(msg.Data, letter); err != nil {
+		return nil, err
+	}
+	letter.Sequence = msg.Sequence
+	return letter, nil
+}
+
+// listHandler lists the dead letters, without their payloads.
+func (q *deadLetterQueue) listHandler(ctx context.Context, message INatsMsg) error {
+	request, err := parseDeadLetterRequest(message)
+	if err != nil {
+		return q.reply(ctx, message, nil, err)
+	}
+	limit := request.Limit
+	if limit <= 0 || limit > deadLetterListLimit {
+		limit = deadLetterListLimit
+	}
+
+	reply := new(deadLetterReply)
+	seq := request.After + 1
+	for len(reply.DeadLetters) < limit {
+		// Get the next dead letter at or after seq, skipping deleted ones.
+		letter, errGet := q.get(ctx, seq, jetstream.WithGetMsgSubject(constants.DeadLetterSubject))
+		if errors.Is(errGet, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if errGet != nil {
+			return q.reply(ctx, message, nil, newHandlerError(errCodeUpstream, errGet))
+		}
+		letter.Data = nil
+		reply.DeadLetters = append(reply.DeadLetters, *letter)
+		seq = letter.Sequence + 1
+	}
+	if len(reply.DeadLetters) == limit {
+		reply.Next = seq - 1
+	}
+
+	return q.reply(ctx, message, reply, nil)
+}
+
+// getHandler replies with a dead letter and its payload.
+func (q *deadLetterQueue) getHandler(ctx context.Context, message INatsMsg) error {
+	request, err := parseDeadLetterSequence(message)
+	if err != nil {
+		return q.reply(ctx, message, nil, err)
+	}
+
+	letter, err := q.get(ctx, request.Sequence)
+	if err != nil {
+		return q.reply(ctx, message, nil, deadLetterError(err))
+	}
+
+	return q.reply(ctx, message, &deadLetterReply{DeadLetter: letter}, nil)
+}
+
+// replayHandler publishes a dead letter again to its original subject, and
+// removes it from the dead-letter stream.
+func (q *deadLetterQueue) replayHandler(ctx context.Context, message INatsMsg) error {
+	request, err := parseDeadLetterSequence(message)
+	if err != nil {
+		return q.reply(ctx, message, nil, err)
+	}
+
+	letter, err := q.get(ctx, request.Sequence)
+	if err != nil {
+		return q.reply(ctx, message, nil, deadLetterError(err))
+	}
+
+	if err = q.replay(ctx, letter.message()); err != nil {
+		logger.With(errKey, err, "sequence", letter.Sequence, "subject", letter.Subject).
+			ErrorContext(ctx, "error replaying dead letter")
+		return q.reply(ctx, message, nil, newHandlerError(errCodeUpstream, err))
+	}
+
+	// The message was replayed, so failing to delete the dead letter is only
+	// logged. It is left for an operator to delete, as replaying it again could
+	// revert a later update of the object.
+	if err = q.stream.DeleteMsg(ctx, letter.Sequence); err != nil {
+		logger.With(errKey, err, "sequence", letter.Sequence).WarnContext(ctx, "error deleting replayed dead letter")
+	}
+	logger.With("sequence", letter.Sequence, "subject", letter.Subject).InfoContext(ctx, "dead letter replayed")
+
+	letter.Data = nil
+	return q.reply(ctx, message, &deadLetterReply{DeadLetter: letter, Replayed: true}, nil)
+}
+
+// replayUnavailable replays the dead letters that failed because OpenFGA was
+// unavailable, once it is available again. Dead letters superseded by a later
+// update or deletion of their object are kept for an operator instead, as
+// replaying them would revert it. Replicas may still replay the same dead
+// letter between reading and deleting it.
+func (q *deadLetterQueue) replayUnavailable(ctx context.Context) {
+	var replayed, superseded int
+	for seq := uint64(1); ; {
+		letter, err := q.get(ctx, seq, jetstream.WithGetMsgSubject(constants.DeadLetterSubject))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			logger.With(errKey, err).ErrorContext(ctx, "error reading dead letters to replay")
+			break
+		}
+		seq = letter.Sequence + 1
+		if letter.Error.Code != errCodeUnavailable {
+			continue
+		}
+		if q.superseded(ctx, letter) {
+			logger.With("sequence", letter.Sequence, "subject", letter.Subject, "object", letter.Object).
+				WarnContext(ctx, "not replaying dead letter superseded by a later update")
+			superseded++
+			continue
+		}
+
+		if err = q.replay(ctx, letter.message()); err != nil {
+			logger.With(errKey, err, "sequence", letter.Sequence, "subject", letter.Subject).
+				ErrorContext(ctx, "error replaying dead letter")
+			continue
+		}
+		if err = q.stream.DeleteMsg(ctx, letter.Sequence); err != nil && !errors.Is(err, jetstream.ErrMsgNotFound) {
+			logger.With(errKey, err, "sequence", letter.Sequence).WarnContext(ctx, "error deleting replayed dead letter")
+		}
+		replayed++
+	}
+
+	logger.With("replayed", replayed, "superseded", superseded).
+		InfoContext(ctx, "replayed dead letters of unavailable OpenFGA")
+}
+
+// message returns the original message of a dead letter.
+func (l *deadLetter) message() *nats.Msg {
+	return &nats.Msg{Subject: l.Subject, Data: l.Data, Header: l.Header}
+}
+
+// replayHeader returns the headers of a message to restore when it is
+// replayed, without the NATS headers set by the server or used by JetStream,
+// such as the message ID which would make the stream drop the replay as a
+// duplicate.
+func replayHeader(header nats.Header) nats.Header {
+	var kept nats.Header
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "nats-") {
+			continue
+		}
+		if kept == nil {
+			kept = nats.Header{}
+		}
+		kept[name] = values
+	}
+	return kept
+}
+
+// objectOrEmpty returns the object of an object error, or an empty string.
+func (e *objectError) objectOrEmpty() string {
+	if e == nil {
+		return ""
+	}
+	return e.object
+}
+
+// replacesObject reports whether the messages of a subject replace the access
+// of their object, rather than adding or removing some of it. A dead letter of
+// such a subject is superseded by a later message of the subject.
+func replacesObject(subject string) bool {
+	return strings.HasPrefix(subject, constants.UpdateAccessSubjectPrefix) ||
+		strings.HasPrefix(subject, constants.DeleteAllAccessSubjectPrefix) ||
+		subject == constants.MeetingRegistrantsSyncSubject
+}
+
+// appliedKey returns the key of when a message of the subject was last applied
+// to the object.
+func appliedKey(subject, object string) string {
+	return cacheKeyEncoder.EncodeToString([]byte(subject + " " + object))
+}
+
+// markApplied records that a message replacing the access of an object was
+// applied. Failures are only logged, as the mark only keeps superseded dead
+// letters from being replayed.
+func (q *deadLetterQueue) markApplied(ctx context.Context, subject, object string) {
+	if q == nil || q.applied == nil || object == "" || !replacesObject(subject) {
+		return
+	}
+	// The timestamp of the entry is what is checked, not its value.
+	if _, err := q.applied.Put(ctx, appliedKey(subject, object), []byte("1")); err != nil {
+		logger.With(errKey, err, "object", object).WarnContext(ctx, "failed to record applied update")
+	}
+}
+
+// superseded reports whether a dead letter was superseded by a later message
+// of its subject replacing the access of its object, or by a later deletion of
+// its object.
+func (q *deadLetterQueue) superseded(ctx context.Context, letter *deadLetter) bool {
+	if q.applied == nil || letter.Object == "" {
+		return false
+	}
+	objectType, _, _ := strings.Cut(letter.Object, ":")
+	subjects := []string{constants.DeleteAllAccessSubjectPrefix + objectType}
+	if replacesObject(letter.Subject) && letter.Subject != subjects[0] {
+		subjects = append(subjects, letter.Subject)
+	}
+	for _, subject := range subjects {
+		entry, err := q.applied.Get(ctx, appliedKey(subject, letter.Object))
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			// Replay when in doubt, as it is only skipped for a known later update.
+			logger.With(errKey, err, "object", letter.Object).WarnContext(ctx, "failed to read applied update")
+			continue
+		}
+		if entry.Created().After(letter.ReceivedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDeadLetterRequest parses the optional payload of a dead-letter admin
+// request.
+func parseDeadLetterRequest(message INatsMsg) (*deadLetterRequest, error) {
+	request := new(deadLetterRequest)
+	if len(message.Data()) == 0 {
+		return request, nil
+	}
+	if err := json.Unmarshal(message.Data(), request); err != nil {
+		return nil, newHandlerError(errCodeInvalidPayload, err)
+	}
+	return request, nil
+}
+
+// parseDeadLetterSequence parses a dead-letter admin request that needs a
+// sequence.
+func parseDeadLetterSequence(message INatsMsg) (*deadLetterRequest, error) {
+	request, err := parseDeadLetterRequest(message)
+	if err != nil {
+		return nil, err
+	}
+	if request.Sequence == 0 {
+		return nil, newHandlerError(errCodeMissingUID, errors.New("dead letter sequence not found"))
+	}
+	return request, nil
+}
+
+// deadLetterError returns the handler error of a failed dead-letter read.
+func deadLetterError(err error) error {
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return newHandlerError(errCodeNotFound, err)
+	}
+	return newHandlerError(errCodeUpstream, err)
+}
+
+// reply sends the reply of a dead-letter admin request. The handler error is
+// returned unchanged, unless the request succeeded and the reply could not be
+// sent.
+func (q *deadLetterQueue) reply(ctx context.Context, message INatsMsg, reply *deadLetterReply, err error) error {
+	if reply == nil {
+		reply = new(deadLetterReply)
+	}
+	if err != nil {
+		reply.Error = &replyError{Code: errorCode(err), Message: err.Error()}
+		logger.With(errKey, err, "subject", message.Subject()).ErrorContext(ctx, "dead-letter request failed")
+	}
+	if message.Reply() == "" {
+		return err
+	}
+
+	data, errMarshal := json.Marshal(reply)
+	if errMarshal != nil {
+		logger.With(errKey, errMarshal).ErrorContext(ctx, "error marshalling dead-letter reply")
+		if err == nil {
+			err = errMarshal
+		}
+		return err
+	}
+	if errRespond := message.Respond(data); errRespond != nil {
+		logger.With(errKey, errRespond).ErrorContext(ctx, "error responding to NATS message")
+		if err == nil {
+			err = errRespond
+		}
+	}
+	return err
+}
@@ -0,0 +1,328 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// storedDeadLetter returns a dead letter as stored in the stream.
+func storedDeadLetter(seq uint64, subject string, data []byte) *jetstream.RawStreamMsg {
+	return &jetstream.RawStreamMsg{
+		Sequence: seq,
+		Data: mustJSON(deadLetter{
+			Subject:  subject,
+			Data:     data,
+			Error:    replyError{Code: errCodeUpstream, Message: "write failed"},
+			Attempts: 10,
+		}),
+	}
+}
+
+// deadLetterReplyWith matches a dead-letter admin reply.
+func deadLetterReplyWith(match func(deadLetterReply) bool) any {
+	return mock.MatchedBy(func(data []byte) bool {
+		var reply deadLetterReply
+		return json.Unmarshal(data, &reply) == nil && match(reply)
+	})
+}
+
+// TestDeadLetterQueueAdd tests the add function
+func TestDeadLetterQueueAdd(t *testing.T) {
+	t.Run("publishes the envelope", func(t *testing.T) {
+		publisher := &MockJetStreamPublisher{}
+		queue := &deadLetterQueue{publisher: publisher}
+		receivedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		publisher.On("Publish", mock.Anything, "lfx.fga-sync.dead_letter", mock.MatchedBy(func(data []byte) bool {
+			var letter deadLetter
+			return json.Unmarshal(data, &letter) == nil &&
+				letter.Subject == "lfx.update_access.project" &&
+				string(letter.Data) == `{"uid":"123"}` &&
+				// The JetStream headers are not kept, as they would not apply to a replay.
+				assert.ObjectsAreEqual(nats.Header{"Request-Id": {"req-1"}, "Dry-Run": {"false"}}, letter.Header) &&
+				letter.Object == "project:123" &&
+				letter.Error.Code == errCodeInvalidPayload &&
+				letter.Attempts == 3 &&
+				letter.ReceivedAt.Equal(receivedAt) &&
+				!letter.FailedAt.IsZero()
+		})).Return(&jetstream.PubAck{Sequence: 7}, nil).Once()
+
+		header := nats.Header{"Request-Id": {"req-1"}, "Dry-Run": {"false"}, "Nats-Msg-Id": {"abc"}}
+		errHandler := &objectError{object: "project:123", err: newHandlerError(errCodeInvalidPayload, errors.New("bad JSON"))}
+		err := queue.add(context.Background(), "lfx.update_access.project", []byte(`{"uid":"123"}`),
+			header, errHandler, 3, receivedAt)
+		assert.NoError(t, err)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		publisher := &MockJetStreamPublisher{}
+		queue := &deadLetterQueue{publisher: publisher}
+		publisher.On("Publish", mock.Anything, mock.Anything, mock.Anything).
+			Return((*jetstream.PubAck)(nil), errors.New("no stream")).Once()
+
+		err := queue.add(context.Background(), "lfx.update_access.project", nil, nil, errors.New("failed"), 1, time.Now())
+		assert.Error(t, err)
+	})
+
+	t.Run("nil queue", func(t *testing.T) {
+		var queue *deadLetterQueue
+		assert.NoError(t, queue.add(context.Background(), "lfx.update_access.project", nil, nil, errors.New("failed"), 1, time.Now()))
+	})
+}
+
+// TestDeadLetterAdminHandlers tests the list, get and replay handlers
+func TestDeadLetterAdminHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       func(*deadLetterQueue) HandlerFunc
+		messageData   []byte
+		setupMocks    func(*MockDeadLetterStream, *MockNatsMsg)
+		expectReplay  string
+		expectedError bool
+	}{
+		{
+			name:        "list skips deleted dead letters and omits payloads",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.listHandler },
+			messageData: nil,
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				stream.On("GetMsg", mock.Anything, uint64(1), true).
+					Return(storedDeadLetter(2, "lfx.update_access.project", []byte("a")), nil).Once()
+				stream.On("GetMsg", mock.Anything, uint64(3), true).
+					Return(storedDeadLetter(5, "lfx.delete_all_access.team", []byte("b")), nil).Once()
+				stream.On("GetMsg", mock.Anything, uint64(6), true).
+					Return((*jetstream.RawStreamMsg)(nil), jetstream.ErrMsgNotFound).Once()
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.Error == nil && reply.Next == 0 && len(reply.DeadLetters) == 2 &&
+						reply.DeadLetters[0].Sequence == 2 && reply.DeadLetters[1].Sequence == 5 &&
+						reply.DeadLetters[0].Data == nil
+				})).Return(nil).Once()
+			},
+		},
+		{
+			name:        "list pages with a limit",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.listHandler },
+			messageData: []byte(`{"after": 4, "limit": 1}`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				stream.On("GetMsg", mock.Anything, uint64(5), true).
+					Return(storedDeadLetter(5, "lfx.update_access.project", nil), nil).Once()
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return len(reply.DeadLetters) == 1 && reply.Next == 5
+				})).Return(nil).Once()
+			},
+		},
+		{
+			name:        "get returns the payload",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.getHandler },
+			messageData: []byte(`{"sequence": 2}`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				stream.On("GetMsg", mock.Anything, uint64(2), false).
+					Return(storedDeadLetter(2, "lfx.update_access.project", []byte(`{"uid":"123"}`)), nil).Once()
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.DeadLetter != nil && reply.DeadLetter.Sequence == 2 &&
+						string(reply.DeadLetter.Data) == `{"uid":"123"}`
+				})).Return(nil).Once()
+			},
+		},
+		{
+			name:        "get missing dead letter",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.getHandler },
+			messageData: []byte(`{"sequence": 9}`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				stream.On("GetMsg", mock.Anything, uint64(9), false).
+					Return((*jetstream.RawStreamMsg)(nil), jetstream.ErrMsgNotFound).Once()
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.Error != nil && reply.Error.Code == errCodeNotFound
+				})).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "get without sequence",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.getHandler },
+			messageData: []byte(`{}`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.Error != nil && reply.Error.Code == errCodeMissingUID
+				})).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "replay publishes to the original subject and deletes the dead letter",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.replayHandler },
+			messageData: []byte(`{"sequence": 2}`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				stream.On("GetMsg", mock.Anything, uint64(2), false).
+					Return(storedDeadLetter(2, "lfx.update_access.project", []byte(`{"uid":"123"}`)), nil).Once()
+				stream.On("DeleteMsg", mock.Anything, uint64(2)).Return(nil).Once()
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.Replayed && reply.DeadLetter.Subject == "lfx.update_access.project"
+				})).Return(nil).Once()
+			},
+			expectReplay: "lfx.update_access.project",
+		},
+		{
+			name:        "invalid JSON",
+			handler:     func(q *deadLetterQueue) HandlerFunc { return q.replayHandler },
+			messageData: []byte(`{invalid`),
+			setupMocks: func(stream *MockDeadLetterStream, msg *MockNatsMsg) {
+				msg.On("Respond", deadLetterReplyWith(func(reply deadLetterReply) bool {
+					return reply.Error != nil && reply.Error.Code == errCodeInvalidPayload
+				})).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			stream := &MockDeadLetterStream{}
+			tt.setupMocks(stream, msg)
+
+			var replayed string
+			queue := &deadLetterQueue{
+				stream: stream,
+				replay: func(_ context.Context, msg *nats.Msg) error {
+					replayed = msg.Subject
+					assert.Equal(t, `{"uid":"123"}`, string(msg.Data))
+					return nil
+				},
+			}
+
+			err := tt.handler(queue)(context.Background(), msg)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectReplay, replayed)
+
+			msg.AssertExpectations(t)
+			stream.AssertExpectations(t)
+		})
+	}
+}
+
+// TestHandleJetStreamMsgDeadLetter tests that JetStream messages are
+// dead-lettered when they fail permanently or too many times.
+func TestHandleJetStreamMsgDeadLetter(t *testing.T) {
+	tests := []struct {
+		name       string
+		handlerErr error
+		delivered  uint64
+		publishErr error
+		setupMocks func(*MockJetStreamMsg)
+		deadLetter bool
+	}{
+		{
+			name:       "permanent error",
+			handlerErr: newHandlerError(errCodeInvalidPayload, errors.New("bad JSON")),
+			delivered:  1,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("TermWithReason", errCodeInvalidPayload).Return(nil).Once()
+			},
+			deadLetter: true,
+		},
+		{
+			name:       "last delivery",
+			handlerErr: newHandlerError(errCodeUpstream, errors.New("write failed")),
+			delivered:  jetstreamMaxDeliver,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("TermWithReason", errCodeUpstream).Return(nil).Once()
+			},
+			deadLetter: true,
+		},
+		{
+			name:       "earlier delivery is redelivered",
+			handlerErr: newHandlerError(errCodeUpstream, errors.New("write failed")),
+			delivered:  2,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("NakWithDelay", 2*time.Second).Return(nil).Once()
+			},
+		},
+		{
+			name:       "message is kept if it cannot be dead-lettered",
+			handlerErr: newHandlerError(errCodeInvalidPayload, errors.New("bad JSON")),
+			delivered:  1,
+			publishErr: errors.New("no stream"),
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("NakWithDelay", time.Second).Return(nil).Once()
+			},
+			deadLetter: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &MockJetStreamPublisher{}
+			if tt.deadLetter {
+				ack := &jetstream.PubAck{Sequence: 1}
+				if tt.publishErr != nil {
+					ack = nil
+				}
+				publisher.On("Publish", mock.Anything, "lfx.fga-sync.dead_letter", mock.Anything).
+					Return(ack, tt.publishErr).Once()
+			}
+			savedQueue := deadLetters
+			deadLetters = &deadLetterQueue{publisher: publisher}
+			defer func() { deadLetters = savedQueue }()
+
+			msg := NewMockJetStreamMsg("lfx.update_access.project", []byte(`{"uid":"123"}`), tt.delivered)
+			tt.setupMocks(msg)
+
+			handleJetStreamMsg(msg, "project update access", func(context.Context, INatsMsg) error {
+				return tt.handlerErr
+			})
+
+			msg.AssertExpectations(t)
+			publisher.AssertExpectations(t)
+		})
+	}
+}
+
+// TestReplySyncApplied tests that applied updates are recorded for the dead
+// letters they supersede, and that failed ones carry their object.
+func TestReplySyncApplied(t *testing.T) {
+	savedQueue := deadLetters
+	defer func() { deadLetters = savedQueue }()
+	applied := NewMockKeyValue()
+	deadLetters = &deadLetterQueue{applied: applied}
+	handlerService := setupService()
+
+	msg := CreateMockNatsMsg(nil)
+	msg.subject = "lfx.update_access.project"
+	err := handlerService.replySync(context.Background(), msg, time.Now(), &syncResult{Object: "project:1"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{appliedKey("lfx.update_access.project", "project:1")}, applied.Keys())
+
+	// Dry runs and partial updates are not recorded.
+	msg.header = nats.Header{"Dry-Run": {"true"}}
+	assert.NoError(t, handlerService.replySync(context.Background(), msg, time.Now(), &syncResult{Object: "project:2"}, nil))
+	msg = CreateMockNatsMsg(nil)
+	msg.subject = "lfx.put_registrant.meeting"
+	assert.NoError(t, handlerService.replySync(context.Background(), msg, time.Now(), &syncResult{Object: "meeting:1"}, nil))
+	assert.Len(t, applied.Keys(), 1)
+
+	errHandler := newHandlerError(errCodeUpstream, errors.New("write failed"))
+	err = handlerService.replySync(context.Background(), msg, time.Now(), &syncResult{Object: "meeting:1"}, errHandler)
+	var errObject *objectError
+	if assert.ErrorAs(t, err, &errObject) {
+		assert.Equal(t, "meeting:1", errObject.object)
+	}
+	assert.ErrorIs(t, err, errHandler)
+	assert.Equal(t, errCodeUpstream, errorCode(err))
+}
@@ -12,6 +12,7 @@ import (
 	"expvar"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -25,17 +26,25 @@ import (
 // Note: all OpenFGA SDK calls are kept in the same file due to the namespace
 // pollution which is the recommended way of using this SDK.
 
+// maxTuplesPerWrite is the maximum number of tuples (writes and deletes) that
+// OpenFGA accepts in a single write transaction.
+const maxTuplesPerWrite = 100
+
 var (
-	cacheHits       *expvar.Int
-	cacheStaleHits  *expvar.Int
-	cacheMisses     *expvar.Int
-	cacheKeyEncoder = base32.StdEncoding.WithPadding(base32.NoPadding)
+	cacheHits      *expvar.Int
+	cacheStaleHits *expvar.Int
+	cacheMisses    *expvar.Int
+	// cacheDegradedHits counts the checks answered from stale cache entries
+	// while OpenFGA is unavailable.
+	cacheDegradedHits *expvar.Int
+	cacheKeyEncoder   = base32.StdEncoding.WithPadding(base32.NoPadding)
 )
 
 func init() {
 	cacheHits = expvar.NewInt("cache_hits")
 	cacheStaleHits = expvar.NewInt("cache_stale_hits")
 	cacheMisses = expvar.NewInt("cache_misses")
+	cacheDegradedHits = expvar.NewInt("cache_degraded_hits")
 }
 
 // INatsKeyValue is a NATS KV interface needed for the [ProjectsService].
@@ -49,6 +58,8 @@ type INatsKeyValue interface {
 type FgaService struct {
 	client      IFgaClient
 	cacheBucket INatsKeyValue
+	// events publishes the access changes, if set.
+	events *accessEventPublisher
 }
 
 // connectFga initializes the global shared fgaClient connection. This demo
@@ -71,11 +82,18 @@ func connectFga() (IFgaClient, error) {
 		ApiUrl:               fgaURL,
 		StoreId:              fgaStoreID,
 		AuthorizationModelId: fgaAuthModelID,
+		// Calls are retried by retryingFgaClient, which doesn't retry writes
+		// that may have been applied.
+		RetryParams: &openfga.RetryParams{MaxRetry: 0, MinWaitInMs: 100},
 	})
 	if err != nil {
 		return nil, err
 	}
-	return FgaAdapter{OpenFgaClient: *fgaClient}, nil
+	fgaBreaker = newCircuitBreaker(breakerThreshold, breakerCooldown)
+	return breakerFgaClient{
+		client:  newRetryingFgaClient(FgaAdapter{OpenFgaClient: *fgaClient}, fgaRetry),
+		breaker: fgaBreaker,
+	}, nil
 }
 
 // NewTupleKeySlice abstracts the creation of a ClientTupleKey slice for our
@@ -127,6 +145,32 @@ func (s FgaService) ReadObjectTuples(ctx context.Context, object string) ([]open
 	return tuples, nil
 }
 
+// ReadUserTuples is a pagination helper to fetch all direct relationships
+// (_no_ transitive evaluations) where the given user is the subject, on objects
+// of the given type. The object type must be in its prefix form, e.g.
+// "project:".
+func (s FgaService) ReadUserTuples(ctx context.Context, user, objectType string) ([]openfga.Tuple, error) {
+	req := ClientReadRequest{
+		User:   openfga.PtrString(user),
+		Object: openfga.PtrString(objectType),
+	}
+	options := ClientReadOptions{}
+	var tuples []openfga.Tuple
+	for {
+		resp, err := s.client.Read(ctx, req, options)
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, resp.Tuples...)
+		if resp.ContinuationToken == "" {
+			break
+		}
+		options.ContinuationToken = openfga.PtrString(resp.ContinuationToken)
+	}
+
+	return tuples, nil
+}
+
 func (s FgaService) getRelationsMap(object string, relations []ClientTupleKey) (map[string]ClientTupleKey, error) {
 	// Convert the passed relationships into a map.
 	relationsMap := make(map[string]ClientTupleKey)
@@ -149,10 +193,15 @@ func (s FgaService) getRelationsMap(object string, relations []ClientTupleKey) (
 	return relationsMap, nil
 }
 
-func (s FgaService) SyncObjectTuples(
+// PlanObjectTuples computes the writes and deletes needed to make the direct
+// relationships of an object match the desired state, without applying them.
+// If owned relations are given, existing tuples with any other relation are
+// left out of the desired state and never deleted.
+func (s FgaService) PlanObjectTuples(
 	ctx context.Context,
 	object string,
 	relations []ClientTupleKey,
+	ownedRelations ...string,
 ) (
 	writes []ClientTupleKey,
 	deletes []ClientTupleKeyWithoutCondition,
@@ -172,8 +221,7 @@ func (s FgaService) SyncObjectTuples(
 	// desired state of relationships passed as a function argument. Any matches
 	// seen are removed from "map" version of the desired relationships. Any live
 	// tuples not requested are added to the "deletes" list for the batch-write
-	// request. Any tuples for "user:<principal>" are added to a NATS message for
-	// a subsequent notify-after-invalidation.
+	// request.
 	for _, tuple := range tuples {
 		// See comment on our map key format earlier in this function.
 		key := tuple.Key.Relation + "@" + tuple.Key.User
@@ -183,12 +231,11 @@ func (s FgaService) SyncObjectTuples(
 			// Desired state matches current state. Remove the match from "desired
 			// state" since we won't need to write/insert it.
 			delete(relationsMap, key)
-			if isUser := strings.HasPrefix(tuple.Key.User, "user:") && tuple.Key.User != "user:*"; isUser {
-				// Save this for a later user-access notification.
-				msg := fmt.Sprintf("%s#%s@%s\ttrue\n", tuple.Key.Object, tuple.Key.Relation, tuple.Key.User)
-				logger.With("message", msg).DebugContext(ctx, "will send user access notification")
-			}
 		case false:
+			if len(ownedRelations) > 0 && !slices.Contains(ownedRelations, tuple.Key.Relation) {
+				// Not managed by this sync.
+				continue
+			}
 			logger.With(
 				"user", tuple.Key.User,
 				"relation", tuple.Key.Relation,
@@ -208,6 +255,49 @@ func (s FgaService) SyncObjectTuples(
 			"object", object,
 		).DebugContext(ctx, "will add relation in batch write")
 		writes = append(writes, relation)
+	}
+
+	return writes, deletes, nil
+}
+
+// SyncObjectTuples makes the direct relationships of an object match the
+// desired state, writing missing tuples and deleting any others. See
+// [FgaService.PlanObjectTuples] for the owned relations.
+func (s FgaService) SyncObjectTuples(
+	ctx context.Context,
+	object string,
+	relations []ClientTupleKey,
+	ownedRelations ...string,
+) (
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+	err error,
+) {
+	writes, deletes, err = s.PlanObjectTuples(ctx, object, relations, ownedRelations...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.seedCache(ctx, writes)
+
+	// Escape early if there is nothing to write or delete.
+	if len(writes) == 0 && len(deletes) == 0 {
+		return writes, deletes, nil
+	}
+
+	// Use the shared write and delete function
+	err = s.WriteAndDeleteTuples(ctx, writes, deletes)
+	if err != nil {
+		return writes, deletes, err
+	}
+
+	return writes, deletes, nil
+}
+
+// seedCache seeds the access check cache with the (direct) user relationships
+// that are about to be written.
+func (s FgaService) seedCache(ctx context.Context, writes []ClientTupleKey) {
+	for _, relation := range writes {
 		if isUser := strings.HasPrefix(relation.User, "user:"); isUser {
 			// Seed any (direct) user relationships to the cache after this function
 			// returns (after the invalidation cache write, if there is one). Only
@@ -233,13 +323,76 @@ func (s FgaService) SyncObjectTuples(
 			}(cacheKey)
 		}
 	}
+}
+
+// PlanPatchObjectTuples computes the writes and deletes needed to add and
+// remove the given direct relationships of an object, without applying them.
+// Relationships that already exist are not written again, and relationships
+// that do not exist are not deleted.
+func (s FgaService) PlanPatchObjectTuples(
+	ctx context.Context,
+	object string,
+	adds []ClientTupleKey,
+	removes []ClientTupleKey,
+) (
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+	err error,
+) {
+	addsMap, err := s.getRelationsMap(object, adds)
+	if err != nil {
+		return nil, nil, err
+	}
+	removesMap, err := s.getRelationsMap(object, removes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tuples, err := s.ReadObjectTuples(ctx, object)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Compare the live tuples against the requested changes: existing tuples
+	// don't need to be added again, and only existing tuples can be removed.
+	for _, tuple := range tuples {
+		key := tuple.Key.Relation + "@" + tuple.Key.User
+		delete(addsMap, key)
+		if _, remove := removesMap[key]; remove {
+			deletes = append(deletes, s.TupleKeyWithoutCondition(tuple.Key.User, tuple.Key.Relation, object))
+		}
+	}
+	for _, relation := range addsMap {
+		writes = append(writes, relation)
+	}
+
+	return writes, deletes, nil
+}
+
+// PatchObjectTuples adds and removes the given direct relationships of an
+// object, leaving any other relationships untouched. See
+// [FgaService.PlanPatchObjectTuples] for the existing relationships.
+func (s FgaService) PatchObjectTuples(
+	ctx context.Context,
+	object string,
+	adds []ClientTupleKey,
+	removes []ClientTupleKey,
+) (
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+	err error,
+) {
+	writes, deletes, err = s.PlanPatchObjectTuples(ctx, object, adds, removes)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Escape early if there is nothing to write or delete.
 	if len(writes) == 0 && len(deletes) == 0 {
 		return writes, deletes, nil
 	}
 
-	// Use the shared write and delete function
+	s.seedCache(ctx, writes)
+
 	err = s.WriteAndDeleteTuples(ctx, writes, deletes)
 	if err != nil {
 		return writes, deletes, err
@@ -261,40 +414,84 @@ func (s FgaService) invalidateCache(ctx context.Context) error {
 
 // WriteAndDeleteTuples writes and/or deletes the given tuples to/from OpenFGA.
 // This is a general-purpose method for modifying tuples without reading existing state.
+//
+// OpenFGA limits the number of tuples in a write transaction, so larger
+// changes are split into transactions of up to [maxTuplesPerWrite] tuples.
+// Writes are sent before deletes, so a relation swapped across two
+// transactions is never missing in between. If a transaction fails, the
+// previous ones stay applied.
+//
+// The access change is recorded in the outbox before the tuples are written,
+// then committed with the tuples of the applied transactions and published, so
+// that it is not lost if the service stops in between.
 func (s FgaService) WriteAndDeleteTuples(
 	ctx context.Context,
 	writes []ClientTupleKey,
 	deletes []ClientTupleKeyWithoutCondition,
 ) error {
+	_, _, err := s.writeAndDeleteTuples(ctx, writes, deletes)
+	return err
+}
+
+// writeAndDeleteTuples implements [FgaService.WriteAndDeleteTuples], and also
+// returns the writes and deletes that were applied, which are only part of
+// them when a later transaction fails.
+func (s FgaService) writeAndDeleteTuples(
+	ctx context.Context,
+	writes []ClientTupleKey,
+	deletes []ClientTupleKeyWithoutCondition,
+) ([]ClientTupleKey, []ClientTupleKeyWithoutCondition, error) {
 	// Return early if there's nothing to do
 	if len(writes) == 0 && len(deletes) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
-	req := ClientWriteRequest{
-		Writes:  writes,
-		Deletes: deletes,
-	}
-
-	_, err := s.client.Write(ctx, req)
+	change, err := s.events.record(ctx, writes, deletes)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Invalidate cache after write
-	if err := s.invalidateCache(ctx); err != nil {
-		// Log but don't fail the operation since the write succeeded
-		logger.With(errKey, err).WarnContext(ctx, "cache invalidation failed")
+	allWrites, allDeletes := writes, deletes
+	var appliedWrites []ClientTupleKey
+	var appliedDeletes []ClientTupleKeyWithoutCondition
+	for len(writes) > 0 || len(deletes) > 0 {
+		var req ClientWriteRequest
+		n := min(len(writes), maxTuplesPerWrite)
+		req.Writes, writes = writes[:n], writes[n:]
+		n = min(len(deletes), maxTuplesPerWrite-len(req.Writes))
+		req.Deletes, deletes = deletes[:n], deletes[n:]
+
+		if _, err := s.client.Write(ctx, req); err != nil {
+			if len(appliedWrites) > 0 || len(appliedDeletes) > 0 {
+				// Earlier transactions were applied.
+				s.invalidateCacheAfterWrite(ctx)
+			}
+			s.events.commit(ctx, change, appliedWrites, appliedDeletes)
+			return appliedWrites, appliedDeletes, err
+		}
+		appliedWrites = append(appliedWrites, req.Writes...)
+		appliedDeletes = append(appliedDeletes, req.Deletes...)
 	}
 
+	s.invalidateCacheAfterWrite(ctx)
+	s.events.commit(ctx, change, allWrites, allDeletes)
+
 	logger.With(
-		"writes_count", len(writes),
-		"deletes_count", len(deletes),
-		"writes", writes,
-		"deletes", deletes,
+		"writes_count", len(allWrites),
+		"deletes_count", len(allDeletes),
+		"writes", allWrites,
+		"deletes", allDeletes,
 	).InfoContext(ctx, "wrote and deleted tuples")
 
-	return nil
+	return allWrites, allDeletes, nil
+}
+
+// invalidateCacheAfterWrite invalidates the cache after a write.
+func (s FgaService) invalidateCacheAfterWrite(ctx context.Context) {
+	if err := s.invalidateCache(ctx); err != nil {
+		// Log but don't fail the operation since the write succeeded
+		logger.With(errKey, err).WarnContext(ctx, "cache invalidation failed")
+	}
 }
 
 // WriteTuples writes the given tuples to OpenFGA without reading or comparing existing tuples.
@@ -404,6 +601,7 @@ func (s FgaService) CheckRelationships(ctx context.Context, tuples []ClientCheck
 	}
 
 	tuplesToCheck := make([]ClientBatchCheckItem, 0) // list of tuples to check in OpenFGA if not in cache
+	staleValues := make(map[string][]byte)           // stale cache entries, by relation key
 	tupleItems := make([]ClientBatchCheckItem, 0, len(tuples))
 	for _, tuple := range tuples {
 		tupleItems = append(tupleItems, ClientBatchCheckItem{
@@ -444,8 +642,9 @@ func (s FgaService) CheckRelationships(ctx context.Context, tuples []ClientCheck
 		}
 
 		// Cache entry was found. If the cache entry is older than the invalidation
-		// timestamp, skip it.
+		// timestamp, skip it, but keep it in case OpenFGA is unavailable.
 		if lastInvalidation.After(entry.Created()) {
+			staleValues[relationKey] = entry.Value()
 			logger.With(
 				"relation_key", relationKey,
 				"last_invalidation", lastInvalidation,
@@ -493,6 +692,9 @@ func (s FgaService) CheckRelationships(ctx context.Context, tuples []ClientCheck
 		Checks: tuplesToCheck,
 	}
 	batchResp, err := s.client.BatchCheck(ctx, batchCheckRequest)
+	if errors.Is(err, errCircuitOpen) && degradedStaleChecks {
+		return staleCheckMessage(ctx, message, tuplesToCheck, staleValues, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -515,6 +717,31 @@ func (s FgaService) CheckRelationships(ctx context.Context, tuples []ClientCheck
 	return message[:len(message)-1], nil
 }
 
+// staleCheckMessage answers the tuples that could not be checked because
+// OpenFGA is unavailable from stale cache entries. The check fails if any
+// tuple has no cache entry.
+func staleCheckMessage(
+	ctx context.Context,
+	message []byte,
+	tuples []ClientBatchCheckItem,
+	staleValues map[string][]byte,
+	errCheck error,
+) ([]byte, error) {
+	for _, tuple := range tuples {
+		relationKey := tuple.Object + "#" + tuple.Relation + "@" + tuple.User
+		value, ok := staleValues[relationKey]
+		if !ok {
+			return nil, errCheck
+		}
+		message = append(message, []byte(relationKey+"\t"+string(value)+"\n")...)
+	}
+	cacheDegradedHits.Add(int64(len(tuples)))
+	logger.With("count", len(tuples)).WarnContext(ctx, "answered access checks from stale cache entries")
+
+	// Trim the last newline and return.
+	return message[:len(message)-1], nil
+}
+
 // ExtractCheckRequests extracts the check requests from our binary message
 // payload format, which is a newline-delineated list of the format
 // `object#relation@user`.
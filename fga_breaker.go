@@ -0,0 +1,242 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+
+	. "github.com/openfga/go-sdk/client"
+)
+
+// Circuit breaker states.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen is returned instead of calling OpenFGA while the circuit
+// breaker is open.
+var errCircuitOpen = errors.New("OpenFGA circuit breaker is open")
+
+var (
+	// fgaBreaker is the circuit breaker of the OpenFGA client, nil until the
+	// client is created.
+	fgaBreaker *circuitBreaker
+	// breakerThreshold is the number of consecutive failed calls that opens
+	// the circuit breaker.
+	breakerThreshold = 5
+	// breakerCooldown is how long the circuit breaker stays open before a
+	// call is let through to probe OpenFGA.
+	breakerCooldown = 30 * time.Second
+	// degradedStaleChecks allows access checks to be answered from stale cache
+	// entries while the circuit breaker is open.
+	degradedStaleChecks bool
+)
+
+func init() {
+	expvar.Publish("fga_circuit", expvar.Func(func() any {
+		return fgaBreaker.State()
+	}))
+}
+
+// loadBreakerConfig loads the circuit breaker configuration from the
+// environment.
+func loadBreakerConfig() error {
+	if threshold := os.Getenv("FGA_BREAKER_THRESHOLD"); threshold != "" {
+		value, err := strconv.Atoi(threshold)
+		if err != nil || value < 1 {
+			return fmt.Errorf("invalid FGA_BREAKER_THRESHOLD %q", threshold)
+		}
+		breakerThreshold = value
+	}
+	if cooldown := os.Getenv("FGA_BREAKER_COOLDOWN"); cooldown != "" {
+		value, err := time.ParseDuration(cooldown)
+		if err != nil || value <= 0 {
+			return fmt.Errorf("invalid FGA_BREAKER_COOLDOWN %q", cooldown)
+		}
+		breakerCooldown = value
+	}
+	degradedStaleChecks = os.Getenv("DEGRADED_STALE_CHECKS") == "true"
+	return nil
+}
+
+// circuitBreaker stops calling OpenFGA after consecutive failures. Once the
+// cooldown has passed, a single call is let through: the breaker closes if it
+// succeeds, and opens again if it fails.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	// onClose is called when the breaker closes after being open.
+	onClose func()
+	now     func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker creates a closed circuit breaker.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     circuitClosed,
+	}
+}
+
+// State returns the state of the breaker. A nil breaker is closed.
+func (b *circuitBreaker) State() string {
+	if b == nil {
+		return circuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter returns how long until the open breaker lets a call through.
+func (b *circuitBreaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitOpen {
+		return 0
+	}
+	return max(b.openedAt.Add(b.cooldown).Sub(b.now()), 0)
+}
+
+// allow reports whether a call may be made, and lets a single probe call
+// through once the cooldown has passed.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Before(b.openedAt.Add(b.cooldown)) {
+			return errCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// A probe call is in flight.
+		return errCircuitOpen
+	}
+	return nil
+}
+
+// record records the outcome of a call. Only errors showing that OpenFGA is
+// unavailable count as failures.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up, which says nothing about OpenFGA. Let the next
+		// call probe it instead.
+		if b.state == circuitHalfOpen {
+			b.state = circuitOpen
+		}
+		b.mu.Unlock()
+		return
+	}
+	if err != nil && isRetryableFgaError(err, true) {
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= b.threshold {
+			if b.state != circuitOpen {
+				logger.With(errKey, err, "failures", b.failures).Warn("OpenFGA circuit breaker opened")
+			}
+			b.state = circuitOpen
+			b.openedAt = b.now()
+		}
+		b.mu.Unlock()
+		return
+	}
+
+	reopened := b.state != circuitClosed
+	b.state = circuitClosed
+	b.failures = 0
+	b.mu.Unlock()
+
+	if reopened {
+		logger.Info("OpenFGA circuit breaker closed")
+		if b.onClose != nil {
+			b.onClose()
+		}
+	}
+}
+
+// breakerFgaClient is an [IFgaClient] that fails fast with [errCircuitOpen]
+// while its circuit breaker is open.
+type breakerFgaClient struct {
+	client  IFgaClient
+	breaker *circuitBreaker
+}
+
+// record records the outcome of a call with the breaker. A call failing after
+// the caller's deadline or cancellation is not held against OpenFGA.
+func (c breakerFgaClient) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		err = context.Canceled
+	}
+	c.breaker.record(err)
+}
+
+// Read implements [IFgaClient.Read].
+func (c breakerFgaClient) Read(
+	ctx context.Context,
+	req ClientReadRequest,
+	options ClientReadOptions,
+) (*ClientReadResponse, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Read(ctx, req, options)
+	c.record(ctx, err)
+	return resp, err
+}
+
+// Write implements [IFgaClient.Write].
+func (c breakerFgaClient) Write(ctx context.Context, req ClientWriteRequest) (*ClientWriteResponse, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Write(ctx, req)
+	c.record(ctx, err)
+	return resp, err
+}
+
+// BatchCheck implements [IFgaClient.BatchCheck].
+func (c breakerFgaClient) BatchCheck(
+	ctx context.Context,
+	request ClientBatchCheckRequest,
+) (*openfga.BatchCheckResponse, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.BatchCheck(ctx, request)
+	c.record(ctx, err)
+	return resp, err
+}
+
+// ReadAuthorizationModel implements [IFgaClient.ReadAuthorizationModel].
+func (c breakerFgaClient) ReadAuthorizationModel(ctx context.Context) (*ClientReadAuthorizationModelResponse, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.ReadAuthorizationModel(ctx)
+	c.record(ctx, err)
+	return resp, err
+}
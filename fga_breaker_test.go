@@ -0,0 +1,288 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestBreaker returns a circuit breaker with a clock set by the test.
+func newTestBreaker(threshold int, now *time.Time) *circuitBreaker {
+	breaker := newCircuitBreaker(threshold, 30*time.Second)
+	breaker.now = func() time.Time { return *now }
+	return breaker
+}
+
+// TestCircuitBreaker tests the circuit breaker states
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	unavailable := fgaStatusError(http.StatusServiceUnavailable)
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		breaker := newTestBreaker(3, &now)
+		breaker.record(unavailable)
+		breaker.record(unavailable)
+		breaker.record(nil)
+		breaker.record(unavailable)
+		breaker.record(unavailable)
+		assert.Equal(t, circuitClosed, breaker.State())
+		assert.NoError(t, breaker.allow())
+
+		breaker.record(unavailable)
+		assert.Equal(t, circuitOpen, breaker.State())
+		assert.ErrorIs(t, breaker.allow(), errCircuitOpen)
+		assert.Equal(t, 30*time.Second, breaker.RetryAfter())
+	})
+
+	t.Run("client errors are not failures", func(t *testing.T) {
+		breaker := newTestBreaker(1, &now)
+		breaker.record(errors.New("invalid tuple"))
+		breaker.record(context.Canceled)
+		assert.Equal(t, circuitClosed, breaker.State())
+	})
+
+	t.Run("probe after the cooldown closes the breaker", func(t *testing.T) {
+		clock := now
+		breaker := newTestBreaker(1, &clock)
+		var closed int
+		breaker.onClose = func() { closed++ }
+		breaker.record(unavailable)
+
+		clock = clock.Add(31 * time.Second)
+		assert.NoError(t, breaker.allow())
+		assert.Equal(t, circuitHalfOpen, breaker.State())
+		// Only one probe call at a time.
+		assert.ErrorIs(t, breaker.allow(), errCircuitOpen)
+
+		breaker.record(nil)
+		assert.Equal(t, circuitClosed, breaker.State())
+		assert.Equal(t, 1, closed)
+	})
+
+	t.Run("failed probe opens the breaker again", func(t *testing.T) {
+		clock := now
+		breaker := newTestBreaker(3, &clock)
+		for range 3 {
+			breaker.record(unavailable)
+		}
+
+		clock = clock.Add(31 * time.Second)
+		assert.NoError(t, breaker.allow())
+		breaker.record(unavailable)
+		assert.Equal(t, circuitOpen, breaker.State())
+		assert.ErrorIs(t, breaker.allow(), errCircuitOpen)
+	})
+
+	t.Run("nil breaker is closed", func(t *testing.T) {
+		var breaker *circuitBreaker
+		assert.Equal(t, circuitClosed, breaker.State())
+		assert.Zero(t, breaker.RetryAfter())
+	})
+}
+
+// TestBreakerFgaClient tests that calls fail fast while the breaker is open
+func TestBreakerFgaClient(t *testing.T) {
+	now := time.Now()
+	mockClient := &MockFgaClient{}
+	client := breakerFgaClient{client: mockClient, breaker: newTestBreaker(2, &now)}
+
+	mockClient.On("Write", mock.Anything, mock.Anything).
+		Return((*ClientWriteResponse)(nil), fgaStatusError(http.StatusServiceUnavailable)).Twice()
+	for range 2 {
+		_, err := client.Write(context.Background(), ClientWriteRequest{})
+		assert.Error(t, err)
+	}
+
+	_, err := client.Read(context.Background(), ClientReadRequest{}, ClientReadOptions{})
+	assert.ErrorIs(t, err, errCircuitOpen)
+	_, err = client.BatchCheck(context.Background(), ClientBatchCheckRequest{})
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, errCodeUnavailable, errorCode(newHandlerError(errCodeUpstream, err)))
+
+	// No call made while open.
+	mockClient.AssertExpectations(t)
+}
+
+// TestBreakerFgaClientCallerDeadline tests that calls failing after the
+// caller's deadline don't open the circuit breaker.
+func TestBreakerFgaClientCallerDeadline(t *testing.T) {
+	now := time.Now()
+	mockClient := &MockFgaClient{}
+	client := breakerFgaClient{client: mockClient, breaker: newTestBreaker(1, &now)}
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
+	defer cancel()
+	mockClient.On("Read", mock.Anything, mock.Anything, mock.Anything).
+		Return((*ClientReadResponse)(nil), context.DeadlineExceeded).Once()
+
+	_, err := client.Read(ctx, ClientReadRequest{}, ClientReadOptions{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, circuitClosed, client.breaker.State())
+}
+
+// TestCheckRelationshipsDegraded tests access checks while OpenFGA is
+// unavailable
+func TestCheckRelationshipsDegraded(t *testing.T) {
+	savedUseCache, savedStale := useCache, degradedStaleChecks
+	defer func() { useCache, degradedStaleChecks = savedUseCache, savedStale }()
+	useCache = true
+
+	invalidation := time.Now()
+	cacheKey := func(relationKey string) string {
+		return "rel." + cacheKeyEncoder.EncodeToString([]byte(relationKey))
+	}
+
+	tests := []struct {
+		name             string
+		staleChecks      bool
+		tuples           []ClientCheckRequest
+		expectedResponse string
+		expectedError    bool
+	}{
+		{
+			name:        "stale entries used when allowed",
+			staleChecks: true,
+			tuples: []ClientCheckRequest{
+				{User: "user:alice", Relation: "viewer", Object: "project:fresh"},
+				{User: "user:alice", Relation: "viewer", Object: "project:stale"},
+			},
+			expectedResponse: "project:fresh#viewer@user:alice\ttrue\nproject:stale#viewer@user:alice\tfalse",
+		},
+		{
+			name:        "stale entries not used by default",
+			staleChecks: false,
+			tuples: []ClientCheckRequest{
+				{User: "user:alice", Relation: "viewer", Object: "project:stale"},
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing entry fails the check",
+			staleChecks: true,
+			tuples: []ClientCheckRequest{
+				{User: "user:alice", Relation: "viewer", Object: "project:stale"},
+				{User: "user:alice", Relation: "viewer", Object: "project:missing"},
+			},
+			expectedError: true,
+		},
+		{
+			name:        "fresh entries need no OpenFGA call",
+			staleChecks: false,
+			tuples: []ClientCheckRequest{
+				{User: "user:alice", Relation: "viewer", Object: "project:fresh"},
+			},
+			expectedResponse: "project:fresh#viewer@user:alice\ttrue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			degradedStaleChecks = tt.staleChecks
+			kv := NewMockKeyValue()
+			kv.data["inv"] = []byte("1")
+			kv.createdTimes["inv"] = invalidation
+			kv.data[cacheKey("project:fresh#viewer@user:alice")] = []byte("true")
+			kv.createdTimes[cacheKey("project:fresh#viewer@user:alice")] = invalidation.Add(time.Second)
+			kv.data[cacheKey("project:stale#viewer@user:alice")] = []byte("false")
+			kv.createdTimes[cacheKey("project:stale#viewer@user:alice")] = invalidation.Add(-time.Second)
+
+			now := time.Now()
+			breaker := newTestBreaker(1, &now)
+			breaker.record(fgaStatusError(http.StatusServiceUnavailable))
+			service := FgaService{client: breakerFgaClient{client: &MockFgaClient{}, breaker: breaker}, cacheBucket: kv}
+
+			response, err := service.CheckRelationships(context.Background(), tt.tuples)
+			if tt.expectedError {
+				assert.ErrorIs(t, err, errCircuitOpen)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedResponse, string(response))
+		})
+	}
+}
+
+// TestHandleJetStreamMsgCircuitOpen tests that messages are kept while
+// OpenFGA is unavailable, however many times they were delivered.
+func TestHandleJetStreamMsgCircuitOpen(t *testing.T) {
+	savedBreaker := fgaBreaker
+	defer func() { fgaBreaker = savedBreaker }()
+	now := time.Now()
+	fgaBreaker = newTestBreaker(1, &now)
+	fgaBreaker.record(fgaStatusError(http.StatusServiceUnavailable))
+
+	msg := NewMockJetStreamMsg("lfx.update_access.project", []byte(`{"uid":"123"}`), jetstreamMaxDeliver+5)
+	msg.On("NakWithDelay", 30*time.Second).Return(nil).Once()
+
+	handleJetStreamMsg(msg, "project update access", func(context.Context, INatsMsg) error {
+		return newHandlerError(errCodeUpstream, errCircuitOpen)
+	})
+
+	msg.AssertExpectations(t)
+}
+
+// TestReplayUnavailable tests that the dead letters of unavailable OpenFGA
+// are replayed with their headers, unless a later update superseded them
+func TestReplayUnavailable(t *testing.T) {
+	receivedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	unavailable := func(seq uint64, subject, object string) *jetstream.RawStreamMsg {
+		return &jetstream.RawStreamMsg{
+			Sequence: seq,
+			Data: mustJSON(deadLetter{
+				Subject:    subject,
+				Data:       []byte(`{"uid":"123"}`),
+				Header:     nats.Header{"Request-Id": {"req-" + strconv.FormatUint(seq, 10)}},
+				Object:     object,
+				Error:      replyError{Code: errCodeUnavailable},
+				ReceivedAt: receivedAt,
+			}),
+		}
+	}
+
+	stream := &MockDeadLetterStream{}
+	stream.On("GetMsg", mock.Anything, uint64(1), true).
+		Return(storedDeadLetter(2, "lfx.update_access.team", nil), nil).Once()
+	stream.On("GetMsg", mock.Anything, uint64(3), true).
+		Return(unavailable(4, "lfx.update_access.project", "project:123"), nil).Once()
+	stream.On("GetMsg", mock.Anything, uint64(5), true).
+		Return(unavailable(5, "lfx.update_access.project", "project:456"), nil).Once()
+	stream.On("GetMsg", mock.Anything, uint64(6), true).
+		Return(unavailable(6, "lfx.put_registrant.meeting", "meeting:789"), nil).Once()
+	stream.On("GetMsg", mock.Anything, uint64(7), true).
+		Return((*jetstream.RawStreamMsg)(nil), jetstream.ErrMsgNotFound).Once()
+	stream.On("DeleteMsg", mock.Anything, uint64(4)).Return(nil).Once()
+
+	// project:456 was updated, and meeting:789 deleted, after the dead letters
+	// of their objects were received.
+	applied := NewMockKeyValue()
+	queue := &deadLetterQueue{stream: stream, applied: applied}
+	queue.markApplied(context.Background(), "lfx.update_access.project", "project:123")
+	queue.markApplied(context.Background(), "lfx.update_access.project", "project:456")
+	queue.markApplied(context.Background(), "lfx.delete_all_access.meeting", "meeting:789")
+	applied.SetCreated(appliedKey("lfx.update_access.project", "project:123"), receivedAt.Add(-time.Minute))
+
+	var replayed []*nats.Msg
+	queue.replay = func(_ context.Context, msg *nats.Msg) error {
+		replayed = append(replayed, msg)
+		return nil
+	}
+	queue.replayUnavailable(context.Background())
+
+	if assert.Len(t, replayed, 1) {
+		assert.Equal(t, "lfx.update_access.project", replayed[0].Subject)
+		assert.Equal(t, "req-4", replayed[0].Header.Get("Request-Id"))
+	}
+	stream.AssertExpectations(t)
+}
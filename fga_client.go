@@ -16,6 +16,7 @@ type IFgaClient interface {
 	Read(ctx context.Context, req ClientReadRequest, options ClientReadOptions) (*ClientReadResponse, error)
 	Write(ctx context.Context, req ClientWriteRequest) (*ClientWriteResponse, error)
 	BatchCheck(ctx context.Context, request ClientBatchCheckRequest) (*openfga.BatchCheckResponse, error)
+	ReadAuthorizationModel(ctx context.Context) (*ClientReadAuthorizationModelResponse, error)
 }
 
 // FgaClient is a wrapper around the OpenFGA client.
@@ -47,3 +48,8 @@ func (c FgaAdapter) Write(
 ) (*ClientWriteResponse, error) {
 	return c.OpenFgaClient.Write(ctx).Body(req).Execute()
 }
+
+// ReadAuthorizationModel reads the configured authorization model.
+func (c FgaAdapter) ReadAuthorizationModel(ctx context.Context) (*ClientReadAuthorizationModelResponse, error) {
+	return c.OpenFgaClient.ReadAuthorizationModel(ctx).Execute()
+}
@@ -0,0 +1,150 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+)
+
+// authModel is the part of an OpenFGA authorization model needed to validate
+// tuples: the directly related user types of each relation, by object type.
+type authModel map[string]map[string][]openfga.RelationReference
+
+// authzModel is the authorization model loaded at startup. Tuples are not
+// validated while it is nil.
+var authzModel authModel
+
+// msgUpdateModelMismatch is logged when the tuples of an access control update
+// are rejected by the authorization model.
+const msgUpdateModelMismatch = "access control update does not match the authorization model"
+
+// ReadAuthorizationModel reads the configured authorization model.
+func (s FgaService) ReadAuthorizationModel(ctx context.Context) (authModel, error) {
+	resp, err := s.client.ReadAuthorizationModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.AuthorizationModel == nil {
+		return nil, errors.New("authorization model not found")
+	}
+
+	model := make(authModel, len(resp.AuthorizationModel.TypeDefinitions))
+	for _, typeDef := range resp.AuthorizationModel.TypeDefinitions {
+		relations := make(map[string][]openfga.RelationReference)
+		if typeDef.Relations != nil {
+			for relation := range *typeDef.Relations {
+				// Relations without metadata are computed only, and cannot be
+				// written directly.
+				relations[relation] = nil
+			}
+		}
+		if typeDef.Metadata != nil && typeDef.Metadata.Relations != nil {
+			for relation, metadata := range *typeDef.Metadata.Relations {
+				if metadata.DirectlyRelatedUserTypes != nil {
+					relations[relation] = *metadata.DirectlyRelatedUserTypes
+				}
+			}
+		}
+		model[typeDef.Type] = relations
+	}
+
+	return model, nil
+}
+
+// validateTuples checks that every tuple can be written to the given object
+// according to the authorization model. A nil model accepts every tuple.
+func (m authModel) validateTuples(object string, tuples []ClientTupleKey) error {
+	if m == nil {
+		return nil
+	}
+
+	objectType, _, _ := strings.Cut(object, ":")
+	relations, ok := m[objectType]
+	if !ok {
+		return fmt.Errorf("object type %q is not defined in the authorization model", objectType)
+	}
+
+	for _, tuple := range tuples {
+		userTypes, ok := relations[tuple.Relation]
+		if !ok {
+			return fmt.Errorf("relation %q is not defined on %s", tuple.Relation, objectType)
+		}
+		if !userTypeAllowed(userTypes, tuple.User) {
+			return fmt.Errorf("user %q cannot be directly related as %s of %s", tuple.User, tuple.Relation, objectType)
+		}
+	}
+
+	return nil
+}
+
+// userTypeAllowed reports whether a tuple user, such as "user:alice", "user:*"
+// or "team:abc#member", matches one of the directly related user types of a
+// relation.
+func userTypeAllowed(userTypes []openfga.RelationReference, user string) bool {
+	userType, id, _ := strings.Cut(user, ":")
+	_, userRelation, isUserset := strings.Cut(id, "#")
+	isWildcard := id == "*"
+
+	for _, ref := range userTypes {
+		if ref.Type != userType {
+			continue
+		}
+		switch {
+		case isWildcard:
+			if ref.Wildcard != nil {
+				return true
+			}
+		case isUserset:
+			if ref.Relation != nil && *ref.Relation == userRelation {
+				return true
+			}
+		default:
+			if ref.Relation == nil && ref.Wildcard == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// modelReference is a way for the objects of a type to reference an object of
+// another type in their tuples.
+type modelReference struct {
+	// objectType is the type of the referencing objects.
+	objectType string
+	// userRelation is set when the object is referenced through one of its
+	// usersets, e.g. "member" for "team:abc#member".
+	userRelation string
+}
+
+// references returns the object types with a relation that can directly
+// reference an object of the given type, either as is or through one of its
+// usersets, in a stable order. A nil model has no references.
+func (m authModel) references(objectType string) []modelReference {
+	var refs []modelReference
+	for _, referencingType := range slices.Sorted(maps.Keys(m)) {
+		relations := m[referencingType]
+		for _, relation := range slices.Sorted(maps.Keys(relations)) {
+			for _, userType := range relations[relation] {
+				if userType.Type != objectType || userType.Wildcard != nil {
+					continue
+				}
+				ref := modelReference{objectType: referencingType, userRelation: userType.GetRelation()}
+				if !slices.Contains(refs, ref) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,279 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testModelResponse returns an authorization model with a committee type,
+// which has a project reference, a writer relation for users and team members,
+// a viewer relation that allows public access, and a computed auditor relation.
+func testModelResponse() *ClientReadAuthorizationModelResponse {
+	wildcard := map[string]interface{}{}
+	return &ClientReadAuthorizationModelResponse{
+		AuthorizationModel: &openfga.AuthorizationModel{
+			Id: "model-123",
+			TypeDefinitions: []openfga.TypeDefinition{
+				{Type: "user"},
+				{Type: "project"},
+				{Type: "team"},
+				{
+					Type: "committee",
+					Relations: &map[string]openfga.Userset{
+						"project": {},
+						"writer":  {},
+						"viewer":  {},
+						"auditor": {},
+					},
+					Metadata: &openfga.Metadata{
+						Relations: &map[string]openfga.RelationMetadata{
+							"project": {DirectlyRelatedUserTypes: &[]openfga.RelationReference{
+								{Type: "project"},
+							}},
+							"writer": {DirectlyRelatedUserTypes: &[]openfga.RelationReference{
+								{Type: "user"},
+								{Type: "team", Relation: openfga.PtrString("member")},
+							}},
+							"viewer": {DirectlyRelatedUserTypes: &[]openfga.RelationReference{
+								{Type: "user"},
+								{Type: "user", Wildcard: &wildcard},
+							}},
+							"auditor": {},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// TestReadAuthorizationModel tests the ReadAuthorizationModel function
+func TestReadAuthorizationModel(t *testing.T) {
+	t.Run("builds the directly related user types", func(t *testing.T) {
+		service := setupService()
+		service.fgaService.client.(*MockFgaClient).On("ReadAuthorizationModel", mock.Anything).
+			Return(testModelResponse(), nil).Once()
+
+		model, err := service.fgaService.ReadAuthorizationModel(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, model, 4)
+		assert.Len(t, model["committee"]["writer"], 2)
+		assert.Contains(t, model["committee"], "auditor")
+		assert.Empty(t, model["committee"]["auditor"])
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		service := setupService()
+		service.fgaService.client.(*MockFgaClient).On("ReadAuthorizationModel", mock.Anything).
+			Return((*ClientReadAuthorizationModelResponse)(nil), assert.AnError).Once()
+
+		_, err := service.fgaService.ReadAuthorizationModel(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("missing model", func(t *testing.T) {
+		service := setupService()
+		service.fgaService.client.(*MockFgaClient).On("ReadAuthorizationModel", mock.Anything).
+			Return(&ClientReadAuthorizationModelResponse{}, nil).Once()
+
+		_, err := service.fgaService.ReadAuthorizationModel(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+// TestValidateTuples tests the validateTuples function
+func TestValidateTuples(t *testing.T) {
+	service := setupService()
+	service.fgaService.client.(*MockFgaClient).On("ReadAuthorizationModel", mock.Anything).
+		Return(testModelResponse(), nil).Once()
+	model, err := service.fgaService.ReadAuthorizationModel(context.Background())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		object        string
+		tuples        []ClientTupleKey
+		expectedError bool
+	}{
+		{
+			name:   "valid tuples",
+			object: "committee:123",
+			tuples: []ClientTupleKey{
+				{User: "project:456", Relation: "project"},
+				{User: "user:alice", Relation: "writer"},
+				{User: "team:abc#member", Relation: "writer"},
+				{User: "user:*", Relation: "viewer"},
+			},
+		},
+		{
+			name:          "undefined object type",
+			object:        "survey:123",
+			tuples:        []ClientTupleKey{{User: "user:alice", Relation: "writer"}},
+			expectedError: true,
+		},
+		{
+			name:          "undefined relation",
+			object:        "committee:123",
+			tuples:        []ClientTupleKey{{User: "user:alice", Relation: "writers"}},
+			expectedError: true,
+		},
+		{
+			name:          "wrong reference type",
+			object:        "committee:123",
+			tuples:        []ClientTupleKey{{User: "team:456", Relation: "project"}},
+			expectedError: true,
+		},
+		{
+			name:          "wildcard not allowed",
+			object:        "committee:123",
+			tuples:        []ClientTupleKey{{User: "user:*", Relation: "writer"}},
+			expectedError: true,
+		},
+		{
+			name:          "userset relation not allowed",
+			object:        "committee:123",
+			tuples:        []ClientTupleKey{{User: "team:abc#writer", Relation: "writer"}},
+			expectedError: true,
+		},
+		{
+			name:          "computed relation",
+			object:        "committee:123",
+			tuples:        []ClientTupleKey{{User: "user:alice", Relation: "auditor"}},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := model.validateTuples(tt.object, tt.tuples)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("nil model accepts every tuple", func(t *testing.T) {
+		var model authModel
+		assert.NoError(t, model.validateTuples("survey:123", []ClientTupleKey{{User: "user:alice", Relation: "any"}}))
+	})
+}
+
+// TestProcessStandardAccessUpdateSchemaViolation tests that updates are
+// checked against the loaded authorization model before syncing.
+func TestProcessStandardAccessUpdateSchemaViolation(t *testing.T) {
+	service := setupService()
+	service.fgaService.client.(*MockFgaClient).On("ReadAuthorizationModel", mock.Anything).
+		Return(testModelResponse(), nil).Once()
+	model, err := service.fgaService.ReadAuthorizationModel(context.Background())
+	assert.NoError(t, err)
+
+	savedModel := authzModel
+	authzModel = model
+	defer func() { authzModel = savedModel }()
+
+	msg := CreateMockNatsMsg(nil)
+	msg.reply = "reply.subject"
+	msg.subject = "lfx.update_access.committee"
+	msg.On("Respond", errorReply(errCodeSchemaViolation)).Return(nil).Once()
+
+	err = service.processStandardAccessUpdate(context.Background(), msg, &standardAccessStub{
+		UID:        "committee-123",
+		ObjectType: "committee",
+		Relations:  map[string][]string{"writers": {"alice"}},
+	})
+	assert.Error(t, err)
+
+	msg.AssertExpectations(t)
+	// No Read or Write operation expected.
+	service.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+}
+
+// TestLegacyUpdateSchemaViolation tests that the project and meeting payloads
+// are checked against the loaded authorization model before syncing.
+func TestLegacyUpdateSchemaViolation(t *testing.T) {
+	savedModel := authzModel
+	authzModel = authModel{
+		"user":      {},
+		"committee": {},
+		"project": {
+			"writer":              {{Type: "user"}},
+			"auditor":             {{Type: "user"}},
+			"meeting_coordinator": {{Type: "user"}},
+			"parent":              {{Type: "project"}},
+		},
+		"meeting": {
+			"organizer": {{Type: "user"}},
+			"project":   {{Type: "project"}},
+			"committee": {{Type: "committee"}},
+		},
+	}
+	defer func() { authzModel = savedModel }()
+
+	tests := []struct {
+		name    string
+		subject string
+		data    string
+		handler func(*HandlerService) HandlerFunc
+	}{
+		{
+			name:    "project userset writer",
+			subject: "lfx.update_access.project",
+			data:    `{"uid": "project-123", "writers": ["committee:c1#member"]}`,
+			handler: func(h *HandlerService) HandlerFunc { return h.projectUpdateAccessHandler },
+		},
+		{
+			name:    "meeting typed organizer",
+			subject: "lfx.update_access.meeting",
+			data:    `{"uid": "meeting-123", "project_uid": "project-123", "organizers": ["team:t1"]}`,
+			handler: func(h *HandlerService) HandlerFunc { return h.meetingUpdateAccessHandler },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := setupService()
+			msg := CreateMockNatsMsg([]byte(tt.data))
+			msg.reply = "reply.subject"
+			msg.subject = tt.subject
+			msg.On("Respond", errorReply(errCodeSchemaViolation)).Return(nil).Once()
+
+			assert.Error(t, tt.handler(service)(context.Background(), msg))
+
+			msg.AssertExpectations(t)
+			// No Read or Write operation expected.
+			service.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
+
+// TestAuthModelReferences tests the references method
+func TestAuthModelReferences(t *testing.T) {
+	model := cascadeTestModel()
+
+	assert.Equal(t, []modelReference{
+		{objectType: "committee"},
+		{objectType: "meeting"},
+		{objectType: "project"},
+	}, model.references("project"))
+	assert.Equal(t, []modelReference{
+		{objectType: "meeting", userRelation: "member"},
+	}, model.references("committee"))
+	// The public wildcard is not a reference to a user.
+	assert.Equal(t, []modelReference{
+		{objectType: "committee"},
+		{objectType: "meeting"},
+		{objectType: "project"},
+	}, model.references("user"))
+	assert.Empty(t, model.references("team"))
+	assert.Empty(t, authModel(nil).references("project"))
+}
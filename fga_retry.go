@@ -0,0 +1,225 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+
+	. "github.com/openfga/go-sdk/client"
+)
+
+// fgaRetryPolicy configures the retries of OpenFGA calls.
+type fgaRetryPolicy struct {
+	// maxAttempts is the number of attempts of a call, including the first.
+	maxAttempts int
+	// baseDelay is the delay before the first retry, doubled for each further
+	// retry up to maxDelay.
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// callTimeout is the deadline of each attempt. Zero means no deadline
+	// other than the caller's.
+	callTimeout time.Duration
+}
+
+var (
+	// fgaRetry is the retry policy of the OpenFGA client.
+	fgaRetry = fgaRetryPolicy{
+		maxAttempts: 4,
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    2 * time.Second,
+		callTimeout: 10 * time.Second,
+	}
+	// fgaRetries counts the retried OpenFGA calls by operation.
+	fgaRetries *expvar.Map
+)
+
+func init() {
+	fgaRetries = expvar.NewMap("fga_retries")
+}
+
+// loadRetryConfig loads the retry policy of OpenFGA calls from the
+// environment.
+func loadRetryConfig() error {
+	if attempts := os.Getenv("FGA_RETRY_ATTEMPTS"); attempts != "" {
+		value, err := strconv.Atoi(attempts)
+		if err != nil || value < 1 {
+			return fmt.Errorf("invalid FGA_RETRY_ATTEMPTS %q", attempts)
+		}
+		fgaRetry.maxAttempts = value
+	}
+	for name, target := range map[string]*time.Duration{
+		"FGA_RETRY_BASE_DELAY": &fgaRetry.baseDelay,
+		"FGA_RETRY_MAX_DELAY":  &fgaRetry.maxDelay,
+		"FGA_CALL_TIMEOUT":     &fgaRetry.callTimeout,
+	} {
+		if duration := os.Getenv(name); duration != "" {
+			value, err := time.ParseDuration(duration)
+			if err != nil || value < 0 {
+				return fmt.Errorf("invalid %s %q", name, duration)
+			}
+			*target = value
+		}
+	}
+	return nil
+}
+
+// retryingFgaClient is an [IFgaClient] that retries failed calls with a
+// jittered exponential backoff. Reads and checks are retried on any transient
+// error, while writes are only retried when the request was not applied.
+type retryingFgaClient struct {
+	client IFgaClient
+	policy fgaRetryPolicy
+	// sleep waits between attempts, unless the context is done first.
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+// newRetryingFgaClient wraps an OpenFGA client with the retry policy.
+func newRetryingFgaClient(client IFgaClient, policy fgaRetryPolicy) retryingFgaClient {
+	return retryingFgaClient{client: client, policy: policy, sleep: sleepContext}
+}
+
+// Read implements [IFgaClient.Read].
+func (c retryingFgaClient) Read(
+	ctx context.Context,
+	req ClientReadRequest,
+	options ClientReadOptions,
+) (resp *ClientReadResponse, err error) {
+	err = c.do(ctx, "read", true, func(ctx context.Context) error {
+		resp, err = c.client.Read(ctx, req, options)
+		return err
+	})
+	return resp, err
+}
+
+// Write implements [IFgaClient.Write]. OpenFGA rejects writing a tuple that
+// exists or deleting one that doesn't, so a write that may have been applied
+// is not retried.
+func (c retryingFgaClient) Write(ctx context.Context, req ClientWriteRequest) (resp *ClientWriteResponse, err error) {
+	err = c.do(ctx, "write", false, func(ctx context.Context) error {
+		resp, err = c.client.Write(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// BatchCheck implements [IFgaClient.BatchCheck].
+func (c retryingFgaClient) BatchCheck(
+	ctx context.Context,
+	request ClientBatchCheckRequest,
+) (resp *openfga.BatchCheckResponse, err error) {
+	err = c.do(ctx, "batch_check", true, func(ctx context.Context) error {
+		resp, err = c.client.BatchCheck(ctx, request)
+		return err
+	})
+	return resp, err
+}
+
+// ReadAuthorizationModel implements [IFgaClient.ReadAuthorizationModel].
+func (c retryingFgaClient) ReadAuthorizationModel(
+	ctx context.Context,
+) (resp *ClientReadAuthorizationModelResponse, err error) {
+	err = c.do(ctx, "read_authorization_model", true, func(ctx context.Context) error {
+		resp, err = c.client.ReadAuthorizationModel(ctx)
+		return err
+	})
+	return resp, err
+}
+
+// do calls an operation until it succeeds, fails with an error that is not
+// retryable, or runs out of attempts. Each attempt has its own deadline.
+func (c retryingFgaClient) do(
+	ctx context.Context,
+	operation string,
+	idempotent bool,
+	call func(ctx context.Context) error,
+) error {
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if c.policy.callTimeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, c.policy.callTimeout)
+		}
+		err := call(callCtx)
+		cancel()
+
+		if err == nil || attempt >= c.policy.maxAttempts || ctx.Err() != nil || !isRetryableFgaError(err, idempotent) {
+			return err
+		}
+
+		delay := c.policy.backoff(attempt)
+		fgaRetries.Add(operation, 1)
+		logger.With(errKey, err, "operation", operation, "attempt", attempt, "delay", delay).
+			WarnContext(ctx, "retrying OpenFGA call")
+
+		if c.sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the jittered delay after the given attempt: a random delay
+// between half and all of the exponential backoff.
+func (p fgaRetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.maxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isRetryableFgaError reports whether a failed OpenFGA call may succeed if it
+// is tried again. Rate limited requests and connections that could not be made
+// were not applied, so they are retried for any operation. Server errors,
+// timeouts and broken connections are only retried for idempotent operations.
+func isRetryableFgaError(err error, idempotent bool) bool {
+	var rateLimitErr openfga.FgaApiRateLimitExceededError
+	if errors.As(err, &rateLimitErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+
+	var internalErr openfga.FgaApiInternalError
+	if errors.As(err, &internalErr) {
+		return internalErr.ResponseStatusCode() != http.StatusNotImplemented
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// sleepContext waits for the delay, or until the context is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fgaStatusError returns the error of the OpenFGA client for a response status.
+func fgaStatusError(status int) error {
+	req, _ := http.NewRequest(http.MethodPost, "http://openfga:8080/stores/store/read", nil)
+	resp := &http.Response{StatusCode: status, Header: http.Header{}, Request: req}
+	if status == http.StatusTooManyRequests {
+		return openfga.NewFgaApiRateLimitExceededError("Write", nil, resp, nil, "store")
+	}
+	return openfga.NewFgaApiInternalError("Read", nil, resp, nil, "store")
+}
+
+// newTestRetryingClient returns a retrying client that doesn't wait between
+// attempts, and records the delays.
+func newTestRetryingClient(client IFgaClient, delays *[]time.Duration) retryingFgaClient {
+	retrying := newRetryingFgaClient(client, fgaRetryPolicy{
+		maxAttempts: 3,
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    time.Second,
+		callTimeout: time.Second,
+	})
+	retrying.sleep = func(_ context.Context, delay time.Duration) error {
+		*delays = append(*delays, delay)
+		return nil
+	}
+	return retrying
+}
+
+// TestRetryingFgaClient tests which calls are retried
+func TestRetryingFgaClient(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name          string
+		call          func(retryingFgaClient) error
+		setupMocks    func(*MockFgaClient)
+		expectedCalls int
+		expectedError bool
+	}{
+		{
+			name: "read retried after a server error",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Read(context.Background(), ClientReadRequest{}, ClientReadOptions{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), fgaStatusError(http.StatusServiceUnavailable)).Once()
+				m.On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{}, nil).Once()
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "read gives up after the last attempt",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Read(context.Background(), ClientReadRequest{}, ClientReadOptions{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), readErr).Times(3)
+			},
+			expectedCalls: 3,
+			expectedError: true,
+		},
+		{
+			name: "read not retried after a client error",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Read(context.Background(), ClientReadRequest{}, ClientReadOptions{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), errors.New("invalid request")).Once()
+			},
+			expectedCalls: 1,
+			expectedError: true,
+		},
+		{
+			name: "check retried after a timeout",
+			call: func(c retryingFgaClient) error {
+				_, err := c.BatchCheck(context.Background(), ClientBatchCheckRequest{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("BatchCheck", mock.Anything, mock.Anything).
+					Return((*openfga.BatchCheckResponse)(nil), context.DeadlineExceeded).Once()
+				m.On("BatchCheck", mock.Anything, mock.Anything).
+					Return(&openfga.BatchCheckResponse{}, nil).Once()
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "write retried when rate limited",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Write(context.Background(), ClientWriteRequest{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), fgaStatusError(http.StatusTooManyRequests)).Once()
+				m.On("Write", mock.Anything, mock.Anything).
+					Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "write retried when the connection could not be made",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Write(context.Background(), ClientWriteRequest{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), dialErr).Once()
+				m.On("Write", mock.Anything, mock.Anything).
+					Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "write not retried after a server error",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Write(context.Background(), ClientWriteRequest{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), fgaStatusError(http.StatusInternalServerError)).Once()
+			},
+			expectedCalls: 1,
+			expectedError: true,
+		},
+		{
+			name: "write not retried after a broken connection",
+			call: func(c retryingFgaClient) error {
+				_, err := c.Write(context.Background(), ClientWriteRequest{})
+				return err
+			},
+			setupMocks: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), readErr).Once()
+			},
+			expectedCalls: 1,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockFgaClient{}
+			tt.setupMocks(mockClient)
+			var delays []time.Duration
+			client := newTestRetryingClient(mockClient, &delays)
+
+			err := tt.call(client)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Len(t, mockClient.Calls, tt.expectedCalls)
+			assert.Len(t, delays, tt.expectedCalls-1)
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+// TestRetryingFgaClientDeadline tests that each attempt has a deadline, and
+// that a canceled caller is not retried.
+func TestRetryingFgaClientDeadline(t *testing.T) {
+	t.Run("attempt deadline", func(t *testing.T) {
+		mockClient := &MockFgaClient{}
+		mockClient.On("ReadAuthorizationModel", mock.MatchedBy(func(ctx context.Context) bool {
+			_, ok := ctx.Deadline()
+			return ok
+		})).Return(&ClientReadAuthorizationModelResponse{}, nil).Once()
+		var delays []time.Duration
+
+		_, err := newTestRetryingClient(mockClient, &delays).ReadAuthorizationModel(context.Background())
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("canceled caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		mockClient := &MockFgaClient{}
+		mockClient.On("Read", mock.Anything, mock.Anything, mock.Anything).
+			Return((*ClientReadResponse)(nil), context.Canceled).Once()
+		var delays []time.Duration
+
+		_, err := newTestRetryingClient(mockClient, &delays).Read(ctx, ClientReadRequest{}, ClientReadOptions{})
+		assert.Error(t, err)
+		assert.Empty(t, delays)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestRetryBackoff tests the backoff function
+func TestRetryBackoff(t *testing.T) {
+	policy := fgaRetryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for range 20 {
+		delay := policy.backoff(1)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 100*time.Millisecond)
+
+		delay = policy.backoff(3)
+		assert.GreaterOrEqual(t, delay, 200*time.Millisecond)
+		assert.LessOrEqual(t, delay, 400*time.Millisecond)
+
+		delay = policy.backoff(10)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, time.Second)
+	}
+}
+
+// TestLoadRetryConfig tests the loadRetryConfig function
+func TestLoadRetryConfig(t *testing.T) {
+	savedPolicy := fgaRetry
+	defer func() { fgaRetry = savedPolicy }()
+
+	t.Setenv("FGA_RETRY_ATTEMPTS", "5")
+	t.Setenv("FGA_RETRY_BASE_DELAY", "50ms")
+	t.Setenv("FGA_CALL_TIMEOUT", "3s")
+	assert.NoError(t, loadRetryConfig())
+	assert.Equal(t, 5, fgaRetry.maxAttempts)
+	assert.Equal(t, 50*time.Millisecond, fgaRetry.baseDelay)
+	assert.Equal(t, 3*time.Second, fgaRetry.callTimeout)
+
+	t.Setenv("FGA_RETRY_ATTEMPTS", "0")
+	assert.Error(t, loadRetryConfig())
+
+	t.Setenv("FGA_RETRY_ATTEMPTS", "")
+	t.Setenv("FGA_RETRY_MAX_DELAY", "soon")
+	assert.Error(t, loadRetryConfig())
+}
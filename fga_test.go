@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/base32"
 	"errors"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -884,3 +885,96 @@ func TestGetTuplesByRelation(t *testing.T) {
 		})
 	}
 }
+
+// TestWriteAndDeleteTuplesChunking tests that large changes are split into
+// write transactions of at most maxTuplesPerWrite tuples, writes first.
+func TestWriteAndDeleteTuplesChunking(t *testing.T) {
+	newWrites := func(n int) []ClientTupleKey {
+		writes := make([]ClientTupleKey, n)
+		for i := range writes {
+			writes[i] = ClientTupleKey{User: "user:u" + strconv.Itoa(i), Relation: "viewer", Object: "project:1"}
+		}
+		return writes
+	}
+	newDeletes := func(n int) []ClientTupleKeyWithoutCondition {
+		deletes := make([]ClientTupleKeyWithoutCondition, n)
+		for i := range deletes {
+			deletes[i] = ClientTupleKeyWithoutCondition{User: "user:d" + strconv.Itoa(i), Relation: "viewer", Object: "project:1"}
+		}
+		return deletes
+	}
+	chunk := func(writes, deletes int) any {
+		return mock.MatchedBy(func(req ClientWriteRequest) bool {
+			return len(req.Writes) == writes && len(req.Deletes) == deletes
+		})
+	}
+
+	tests := []struct {
+		name        string
+		writes      int
+		deletes     int
+		mockSetup   func(*MockFgaClient)
+		invalidated bool
+		expectError bool
+	}{
+		{
+			name:   "single transaction",
+			writes: 60, deletes: 40,
+			mockSetup: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, chunk(60, 40)).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			invalidated: true,
+		},
+		{
+			name:   "writes then deletes in chunks",
+			writes: 150, deletes: 70,
+			mockSetup: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, chunk(100, 0)).Return(&ClientWriteResponse{}, nil).Once()
+				m.On("Write", mock.Anything, chunk(50, 50)).Return(&ClientWriteResponse{}, nil).Once()
+				m.On("Write", mock.Anything, chunk(0, 20)).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			invalidated: true,
+		},
+		{
+			name:   "failure after a partial write invalidates the cache",
+			writes: 150, deletes: 0,
+			mockSetup: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, chunk(100, 0)).Return(&ClientWriteResponse{}, nil).Once()
+				m.On("Write", mock.Anything, chunk(50, 0)).Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+			},
+			invalidated: true,
+			expectError: true,
+		},
+		{
+			name:   "failure of the first transaction",
+			writes: 10, deletes: 0,
+			mockSetup: func(m *MockFgaClient) {
+				m.On("Write", mock.Anything, chunk(10, 0)).Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockFgaClient{}
+			mockKV := NewMockKeyValue()
+			tt.mockSetup(mockClient)
+			fgaService := FgaService{client: mockClient, cacheBucket: mockKV}
+
+			err := fgaService.WriteAndDeleteTuples(context.Background(), newWrites(tt.writes), newDeletes(tt.deletes))
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if _, ok := mockKV.data["inv"]; ok != tt.invalidated {
+				t.Errorf("cache invalidated: got %v, want %v", ok, tt.invalidated)
+			}
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
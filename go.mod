@@ -7,6 +7,7 @@ go 1.23.0
 
 require (
 	github.com/nats-io/nats.go v1.43.0
+	github.com/nats-io/nuid v1.0.1
 	github.com/openfga/go-sdk v0.7.1
 	github.com/stretchr/testify v1.10.0
 )
@@ -17,7 +18,6 @@ require (
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/nats-io/nkeys v0.4.11 // indirect
-	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sourcegraph/conc v0.3.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
@@ -5,11 +5,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
 	nats "github.com/nats-io/nats.go"
+	"github.com/openfga/go-sdk/client"
 )
 
 // HandlerService is the service that handles the messages from NATS about FGA syncing.
@@ -19,11 +23,67 @@ type HandlerService struct {
 
 // standardAccessStub represents the default structure for access control objects
 type standardAccessStub struct {
-	UID        string              `json:"uid"`
-	ObjectType string              `json:"object_type"`
-	Public     bool                `json:"public"`
-	Relations  map[string][]string `json:"relations"`
-	References map[string]string   `json:"references"`
+	UID        string                   `json:"uid"`
+	ObjectType string                   `json:"object_type"`
+	Public     bool                     `json:"public"`
+	Relations  map[string][]string      `json:"relations"`
+	References map[string]referenceList `json:"references"`
+}
+
+// objectReference is an object referenced by an access control object, e.g.
+// its parent or project. Without a type, the type is derived from the
+// reference relation, see [referenceType].
+type objectReference struct {
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id"`
+}
+
+// referenceList is the list of objects referenced through one relation. In a
+// payload, it can be a single ID, a typed reference, or a list of either.
+type referenceList []objectReference
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (r *referenceList) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+	} else {
+		items = []json.RawMessage{data}
+	}
+
+	refs := make(referenceList, 0, len(items))
+	for _, item := range items {
+		var ref objectReference
+		if len(item) > 0 && item[0] == '{' {
+			if err := json.Unmarshal(item, &ref); err != nil {
+				return err
+			}
+		} else if err := json.Unmarshal(item, &ref.ID); err != nil {
+			return err
+		}
+		if ref.ID == "" {
+			return errors.New("reference without an ID")
+		}
+		refs = append(refs, ref)
+	}
+
+	*r = refs
+	return nil
+}
+
+// hasObjectType reports whether a payload sets the "object_type" of the
+// standard access format. Object types that predate the standard format use it
+// to tell the two payloads apart.
+func hasObjectType(data []byte) bool {
+	var probe struct {
+		ObjectType string `json:"object_type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.ObjectType != ""
 }
 
 // INatsMsg is an interface for [nats.Msg] that allows for mocking.
@@ -32,6 +92,7 @@ type INatsMsg interface {
 	Respond(data []byte) error
 	Data() []byte
 	Subject() string
+	Header() nats.Header
 }
 
 // NatsMsg is a wrapper around [nats.Msg] that implements [INatsMsg].
@@ -44,9 +105,14 @@ func (m *NatsMsg) Reply() string {
 	return m.Msg.Reply
 }
 
-// Respond implements [INatsMsg.Respond].
+// Respond implements [INatsMsg.Respond]. The request ID and trace context
+// headers of the request are echoed in the reply.
 func (m *NatsMsg) Respond(data []byte) error {
-	return m.Msg.Respond(data)
+	header := echoHeaders(m.Msg.Header)
+	if header == nil {
+		return m.Msg.Respond(data)
+	}
+	return m.Msg.RespondMsg(&nats.Msg{Data: data, Header: header})
 }
 
 // Data implements [INatsMsg.Data].
@@ -59,20 +125,239 @@ func (m *NatsMsg) Subject() string {
 	return m.Msg.Subject
 }
 
-// processStandardAccessUpdate handles the default access control update logic
-func (h *HandlerService) processStandardAccessUpdate(message INatsMsg, obj *standardAccessStub) error {
-	ctx := context.Background()
+// Header implements [INatsMsg.Header].
+func (m *NatsMsg) Header() nats.Header {
+	return m.Msg.Header
+}
 
-	logger.With("message", string(message.Data())).InfoContext(ctx, "handling "+obj.ObjectType+" access control update")
+// Error codes returned to callers in the reply of update and delete requests.
+const (
+	// errCodeInvalidPayload is returned when the message payload cannot be parsed.
+	errCodeInvalidPayload = "invalid_payload"
+	// errCodeMissingUID is returned when a required object or user ID is missing.
+	errCodeMissingUID = "missing_uid"
+	// errCodeSchemaViolation is returned when the payload does not match the
+	// OpenFGA authorization model.
+	errCodeSchemaViolation = "schema_violation"
+	// errCodeUpstream is returned when an OpenFGA request fails.
+	errCodeUpstream = "upstream_error"
+	// errCodeUnavailable is returned when OpenFGA is not called because its
+	// circuit breaker is open.
+	errCodeUnavailable = "fga_unavailable"
+	// errCodeOverloaded is returned when a request is rejected because the
+	// queue of its subject is full.
+	errCodeOverloaded = "overloaded"
+	// errCodeInternal is returned for any other error.
+	errCodeInternal = "internal_error"
+)
 
-	if obj.UID == "" {
-		logger.ErrorContext(ctx, obj.ObjectType+" ID not found")
-		return errors.New(obj.ObjectType + " ID not found")
+// handlerError is a handler error carrying a machine-readable code for the
+// reply.
+type handlerError struct {
+	code string
+	err  error
+}
+
+// newHandlerError wraps an error with a reply error code.
+func newHandlerError(code string, err error) error {
+	return &handlerError{code: code, err: err}
+}
+
+// Error implements [error].
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// errorCode returns the reply error code for an error returned by a handler.
+func errorCode(err error) string {
+	if errors.Is(err, errCircuitOpen) {
+		return errCodeUnavailable
 	}
+	var handlerErr *handlerError
+	if errors.As(err, &handlerErr) {
+		return handlerErr.code
+	}
+	return errCodeInternal
+}
 
-	object := fmt.Sprintf("%s:%s", obj.ObjectType, obj.UID)
+// replyError is the error section of an update or delete reply.
+type replyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
 
-	// Build a list of tuples to sync.
+// syncResult is the outcome of an update or delete request, and the reply body
+// sent back to the caller.
+type syncResult struct {
+	Object  string                                  `json:"object,omitempty"`
+	DryRun  bool                                    `json:"dry_run"`
+	Writes  []client.ClientTupleKey                 `json:"writes"`
+	Deletes []client.ClientTupleKeyWithoutCondition `json:"deletes"`
+	Cascade *cascadeResult                          `json:"cascade,omitempty"`
+	// Registrants are the outcomes of a bulk registrant request.
+	Registrants []registrantResult `json:"registrants,omitempty"`
+	ElapsedMs   float64            `json:"elapsed_ms"`
+	Error       *replyError        `json:"error,omitempty"`
+}
+
+// isDryRun reports whether the message was received on a dry-run subject, or
+// asks for a dry run with its dry-run header.
+func isDryRun(message INatsMsg) bool {
+	subject := message.Subject()
+	return strings.HasPrefix(subject, constants.UpdateAccessDryRunSubjectPrefix) ||
+		strings.HasPrefix(subject, constants.DeleteAllAccessDryRunSubjectPrefix) ||
+		strings.EqualFold(headerValue(message.Header(), constants.DryRunHeader), "true")
+}
+
+// dryRunSubject returns the dry-run variant of an update or delete subject, or
+// an empty string if the subject has none.
+func dryRunSubject(subject string) string {
+	switch {
+	case strings.HasPrefix(subject, constants.UpdateAccessSubjectPrefix):
+		return constants.UpdateAccessDryRunSubjectPrefix + strings.TrimPrefix(subject, constants.UpdateAccessSubjectPrefix)
+	case strings.HasPrefix(subject, constants.DeleteAllAccessSubjectPrefix):
+		return constants.DeleteAllAccessDryRunSubjectPrefix +
+			strings.TrimPrefix(subject, constants.DeleteAllAccessSubjectPrefix)
+	default:
+		return ""
+	}
+}
+
+// syncObjectTuples syncs the tuples of an object, or only computes the diff
+// when the message asks for a dry run. If owned relations are given, only
+// existing tuples with those relations are replaced.
+func (h *HandlerService) syncObjectTuples(
+	ctx context.Context,
+	message INatsMsg,
+	object string,
+	tuples []client.ClientTupleKey,
+	ownedRelations ...string,
+) ([]client.ClientTupleKey, []client.ClientTupleKeyWithoutCondition, error) {
+	if isDryRun(message) {
+		return h.fgaService.PlanObjectTuples(ctx, object, tuples, ownedRelations...)
+	}
+	return h.fgaService.SyncObjectTuples(ctx, object, tuples, ownedRelations...)
+}
+
+// patchObjectTuples adds and removes tuples of an object, or only computes the
+// diff when the message asks for a dry run.
+func (h *HandlerService) patchObjectTuples(
+	ctx context.Context,
+	message INatsMsg,
+	object string,
+	adds []client.ClientTupleKey,
+	removes []client.ClientTupleKey,
+) ([]client.ClientTupleKey, []client.ClientTupleKeyWithoutCondition, error) {
+	if isDryRun(message) {
+		return h.fgaService.PlanPatchObjectTuples(ctx, object, adds, removes)
+	}
+	return h.fgaService.PatchObjectTuples(ctx, object, adds, removes)
+}
+
+// writeAndDeleteTuples writes and deletes planned tuples, unless the message
+// asks for a dry run, and returns the tuples that were applied, or would be.
+func (h *HandlerService) writeAndDeleteTuples(
+	ctx context.Context,
+	message INatsMsg,
+	writes []client.ClientTupleKey,
+	deletes []client.ClientTupleKeyWithoutCondition,
+) ([]client.ClientTupleKey, []client.ClientTupleKeyWithoutCondition, error) {
+	if isDryRun(message) {
+		return writes, deletes, nil
+	}
+	return h.fgaService.writeAndDeleteTuples(ctx, writes, deletes)
+}
+
+// replySync sends the structured reply for an update or delete request if an
+// inbox was provided. The handler error is returned with the object of the
+// request, for its dead letter, unless the request succeeded and the reply
+// could not be sent.
+func (h *HandlerService) replySync(
+	ctx context.Context,
+	message INatsMsg,
+	start time.Time,
+	result *syncResult,
+	err error,
+) error {
+	if result != nil && result.Object != "" {
+		if err != nil {
+			err = &objectError{object: result.Object, err: err}
+		} else if !isDryRun(message) {
+			deadLetters.markApplied(ctx, message.Subject(), result.Object)
+		}
+	}
+	if message.Reply() == "" {
+		return err
+	}
+
+	if result == nil {
+		result = new(syncResult)
+	}
+	result.DryRun = isDryRun(message)
+	result.ElapsedMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = &replyError{Code: errorCode(err), Message: err.Error()}
+	}
+	// Always serialize empty lists rather than null.
+	if result.Writes == nil {
+		result.Writes = []client.ClientTupleKey{}
+	}
+	if result.Deletes == nil {
+		result.Deletes = []client.ClientTupleKeyWithoutCondition{}
+	}
+
+	reply, errMarshal := json.Marshal(result)
+	if errMarshal != nil {
+		logger.With(errKey, errMarshal).ErrorContext(ctx, "failed to build reply")
+		if err != nil {
+			return err
+		}
+		return errMarshal
+	}
+
+	if errRespond := message.Respond(reply); errRespond != nil {
+		logger.With(errKey, errRespond).WarnContext(ctx, "failed to send reply")
+		if err != nil {
+			return err
+		}
+		return errRespond
+	}
+
+	logger.With(
+		"object", result.Object,
+		"subject", message.Subject(),
+		"error_code", errorCodeOrEmpty(result.Error),
+	).InfoContext(ctx, "sent access control response")
+
+	return err
+}
+
+// errorCodeOrEmpty returns the code of a reply error, or an empty string.
+func errorCodeOrEmpty(replyErr *replyError) string {
+	if replyErr == nil {
+		return ""
+	}
+	return replyErr.Code
+}
+
+// principalUser returns the OpenFGA user for a principal of an update payload.
+// Plain usernames are users, while typed principals such as "team:abc" and
+// usersets such as "committee:xyz#member" are used as they are.
+func principalUser(principal string) string {
+	if strings.Contains(principal, ":") {
+		return principal
+	}
+	return constants.ObjectTypeUser + principal
+}
+
+// buildStandardAccessTuples builds the tuples described by a standard access
+// payload for the given object.
+func (h *HandlerService) buildStandardAccessTuples(object string, obj *standardAccessStub) []client.ClientTupleKey {
 	tuples := h.fgaService.NewTupleKeySlice(4)
 
 	// Convert the "public" attribute to a "user:*" relation.
@@ -81,58 +366,95 @@ func (h *HandlerService) processStandardAccessUpdate(message INatsMsg, obj *stan
 	}
 
 	// for parent relation, project relation, etc
-	for reference, value := range obj.References {
-		refType := reference
-		if reference == constants.RelationParent {
-			refType = obj.ObjectType
+	for reference, refs := range obj.References {
+		for _, ref := range refs {
+			refType := ref.Type
+			if refType == "" {
+				refType = referenceType(obj.ObjectType, reference)
+			}
+
+			key := fmt.Sprintf("%s:%s", refType, ref.ID)
+			tuples = append(tuples, h.fgaService.TupleKey(key, reference, object))
 		}
-
-		key := fmt.Sprintf("%s:%s", refType, value)
-		tuples = append(tuples, h.fgaService.TupleKey(key, reference, object))
 	}
 
 	// Add each principal from the object as the corresponding relationship tuple
-	// (as defined in the OpenFGA schema).
+	// (as defined in the OpenFGA schema). Principals are usernames, typed
+	// principals or usersets, see [principalUser].
 	// for writer, auditor etc
 	for relation, principals := range obj.Relations {
 		for _, principal := range principals {
-			tuples = append(tuples, h.fgaService.TupleKey(constants.ObjectTypeUser+principal, relation, object))
+			tuples = append(tuples, h.fgaService.TupleKey(principalUser(principal), relation, object))
 		}
 	}
 
-	tuplesWrites, tuplesDeletes, err := h.fgaService.SyncObjectTuples(ctx, object, tuples)
+	return tuples
+}
+
+// processStandardAccessUpdate handles the default access control update logic
+func (h *HandlerService) processStandardAccessUpdate(
+	ctx context.Context,
+	message INatsMsg,
+	obj *standardAccessStub,
+) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
+
+	logger.With("message", string(message.Data())).InfoContext(ctx, "handling "+obj.ObjectType+" access control update")
+
+	if obj.UID == "" {
+		logger.ErrorContext(ctx, obj.ObjectType+" ID not found")
+		return newHandlerError(errCodeMissingUID, errors.New(obj.ObjectType+" ID not found"))
+	}
+
+	object := fmt.Sprintf("%s:%s", obj.ObjectType, obj.UID)
+	result.Object = object
+
+	if err = validateStandardAccess(obj); err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, "invalid access control update")
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+
+	// Build a list of tuples to sync.
+	tuples := h.buildStandardAccessTuples(object, obj)
+
+	if err = authzModel.validateTuples(object, tuples); err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, msgUpdateModelMismatch)
+		return newHandlerError(errCodeSchemaViolation, err)
+	}
+
+	result.Writes, result.Deletes, err = h.syncObjectTuples(
+		ctx, message, object, tuples, ownedRelations(obj.ObjectType)...,
+	)
 	if err != nil {
 		logger.With(errKey, err, "tuples", tuples, "object", object).ErrorContext(ctx, "failed to sync tuples")
-		return err
+		return newHandlerError(errCodeUpstream, err)
 	}
 
 	logger.With(
 		"tuples", tuples,
 		"object", object,
-		"writes", tuplesWrites,
-		"deletes", tuplesDeletes,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+		"dry_run", isDryRun(message),
 	).InfoContext(ctx, "synced tuples")
 
-	if message.Reply() != "" {
-		// Send a reply if an inbox was provided.
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
-		}
-
-		logger.With("object", object).InfoContext(ctx, "sent "+obj.ObjectType+" access control update response")
-	}
-
 	return nil
 }
 
 // processDeleteAllAccessMessage handles the common logic for deleting all access tuples for an object
 func (h *HandlerService) processDeleteAllAccessMessage(
+	ctx context.Context,
 	message INatsMsg,
 	objectTypePrefix,
 	objectTypeName string,
-) error {
-	ctx := context.Background()
+) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
 
 	logger.InfoContext(
 		ctx,
@@ -143,40 +465,43 @@ func (h *HandlerService) processDeleteAllAccessMessage(
 	objectUID := string(message.Data())
 	if objectUID == "" {
 		logger.ErrorContext(ctx, "empty deletion payload")
-		return errors.New("empty deletion payload")
+		return newHandlerError(errCodeMissingUID, errors.New("empty deletion payload"))
 	}
 	if objectUID[0] == '{' || objectUID[0] == '[' || objectUID[0] == '"' {
 		// This event payload is not supposed to be serialized.
 		logger.ErrorContext(ctx, "unsupported deletion payload")
-		return errors.New("unsupported deletion payload")
+		return newHandlerError(errCodeInvalidPayload, errors.New("unsupported deletion payload"))
 	}
 
 	object := objectTypePrefix + objectUID
+	result.Object = object
 
 	// Since this is a delete, we can call SyncObjectTuples directly
 	// with a zero-value (nil) slice.
-	tuplesWrites, tuplesDeletes, err := h.fgaService.SyncObjectTuples(ctx, object, nil)
+	result.Writes, result.Deletes, err = h.syncObjectTuples(ctx, message, object, nil)
 	if err != nil {
 		logger.With(errKey, err, "object", object).ErrorContext(ctx, "failed to sync tuples")
-		return err
+		return newHandlerError(errCodeUpstream, err)
 	}
 
 	logger.InfoContext(
 		ctx,
 		"synced tuples",
 		"object", object,
-		"writes", tuplesWrites,
-		"deletes", tuplesDeletes,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+		"dry_run", isDryRun(message),
 	)
 
-	if message.Reply() != "" {
-		// Send a reply if an inbox was provided.
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
+	// Clean up the tuples that still reference the deleted object. A failed
+	// cascade fails the deletion, so that it is retried: the object's own
+	// tuples are already deleted, and the cascade finds what is left.
+	if cascadeMode != cascadeOff {
+		result.Cascade, err = h.cascadeDelete(ctx, message, object)
+		if err != nil {
+			logger.With(errKey, err, "object", object).ErrorContext(ctx, "failed to cascade access deletion")
+			return newHandlerError(errCodeUpstream, err)
 		}
-
-		logger.With("object", object).InfoContext(ctx, "sent "+objectTypeName+" access control delete all response")
 	}
 
 	return nil
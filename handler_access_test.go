@@ -4,11 +4,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	nats "github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	openfga "github.com/openfga/go-sdk"
 	"github.com/openfga/go-sdk/client"
@@ -30,6 +35,11 @@ func init() {
 		logger = slog.New(slog.NewTextHandler(os.Stdout, logOptions))
 		slog.SetDefault(logger)
 	}
+
+	// Use the default object type registry.
+	if err := loadObjectTypes(); err != nil {
+		panic(err)
+	}
 }
 
 // setupService creates a new ProjectsService with mocked external service APIs.
@@ -47,6 +57,22 @@ func setupService() *HandlerService {
 	return service
 }
 
+// successReply matches a structured update reply without an error.
+func successReply() any {
+	return mock.MatchedBy(func(data []byte) bool {
+		var reply syncResult
+		return json.Unmarshal(data, &reply) == nil && reply.Error == nil
+	})
+}
+
+// errorReply matches a structured update reply with the given error code.
+func errorReply(code string) any {
+	return mock.MatchedBy(func(data []byte) bool {
+		var reply syncResult
+		return json.Unmarshal(data, &reply) == nil && reply.Error != nil && reply.Error.Code == code
+	})
+}
+
 // TestAccessCheckHandler tests the [accessCheckHandler] function.
 func TestAccessCheckHandler(t *testing.T) {
 	tests := []struct {
@@ -172,7 +198,7 @@ func TestAccessCheckHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.accessCheckHandler(msg)
+				err := handlerService.accessCheckHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -209,11 +235,11 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "committee",
 				Public:     true,
 				Relations:  map[string][]string{"writer": {"user1", "user2"}},
-				References: map[string]string{"parent": "parent-123"},
+				References: map[string]referenceList{"parent": {{ID: "parent-123"}}},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have: public viewer, parent relation, 2 writers = 4 tuples
 					return len(req.Writes) == 4 && len(req.Deletes) == 0
@@ -235,15 +261,15 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 					"viewer":  {"user4", "user5", "user6"},
 					"admin":   {"user7"},
 				},
-				References: map[string]string{
-					"parent":  "parent-456",
-					"project": "project-789",
-					"team":    "team-101",
+				References: map[string]referenceList{
+					"parent":  {{ID: "parent-456"}},
+					"project": {{ID: "project-789"}},
+					"team":    {{ID: "team-101"}},
 				},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have: 3 references + 7 relations (no public) = 10 tuples
 					return len(req.Writes) == 10 && len(req.Deletes) == 0
@@ -260,11 +286,11 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "committee",
 				Public:     true,
 				Relations:  map[string][]string{"owner": {"user1"}},
-				References: map[string]string{"parent": "parent-committee-456"},
+				References: map[string]referenceList{"parent": {{ID: "parent-committee-456"}}},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have: 1 public viewer + 1 parent (with committee: prefix) + 1 owner = 3 tuples
 					if len(req.Writes) != 3 || len(req.Deletes) != 0 {
@@ -284,6 +310,33 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 			expectedCalled: true,
 		},
 
+		{
+			name: "userset and typed principals",
+			obj: &standardAccessStub{
+				UID:        "userset-123",
+				ObjectType: "groupsio_service",
+				Relations: map[string][]string{
+					"writer":  {"team:abc#member", "user1"},
+					"auditor": {"committee:xyz#member"},
+				},
+			},
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
+					users := make(map[string]bool)
+					for _, tuple := range req.Writes {
+						users[tuple.User] = true
+					}
+					return len(req.Writes) == 3 &&
+						users["team:abc#member"] && users["user:user1"] && users["committee:xyz#member"]
+				})).Return(&client.ClientWriteResponse{}, nil)
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&client.ClientReadResponse{}, nil)
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+
 		// Hard Tests - Error scenarios and edge cases
 		{
 			name: "missing UID should fail",
@@ -292,14 +345,15 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "committee",
 				Public:     true,
 				Relations:  map[string][]string{"writer": {"user1"}},
-				References: map[string]string{},
+				References: map[string]referenceList{},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed as function should fail early
+				// Should fail early and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name: "FGA sync failure should propagate error",
@@ -308,16 +362,17 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "groupsio_service",
 				Public:     true,
 				Relations:  map[string][]string{"writer": {"user1"}},
-				References: map[string]string{},
+				References: map[string]referenceList{},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
 				// Mock FGA service to return error
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).Return((*client.ClientWriteResponse)(nil), assert.AnError)
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&client.ClientReadResponse{}, nil)
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name: "empty relations and references with public access",
@@ -326,11 +381,11 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "committee",
 				Public:     true,
 				Relations:  map[string][]string{},
-				References: map[string]string{},
+				References: map[string]referenceList{},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have only 1 tuple: public viewer
 					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
@@ -348,7 +403,7 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "groupsio_service",
 				Public:     false,
 				Relations:  map[string][]string{"writer": {"user1"}},
-				References: map[string]string{},
+				References: map[string]referenceList{},
 			},
 			replySubject: "",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
@@ -366,11 +421,11 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 				ObjectType: "committee",
 				Public:     true,
 				Relations:  map[string][]string{},
-				References: map[string]string{},
+				References: map[string]referenceList{},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(assert.AnError).Once()
+				msg.On("Respond", successReply()).Return(assert.AnError).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).Return(&client.ClientWriteResponse{}, nil)
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&client.ClientReadResponse{}, nil)
 			},
@@ -392,17 +447,17 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 					"admin":   {"user13"},
 					"owner":   {"user14", "user15"},
 				},
-				References: map[string]string{
-					"parent":     "parent-999",
-					"project":    "project-888",
-					"team":       "team-777",
-					"department": "dept-666",
-					"region":     "region-555",
+				References: map[string]referenceList{
+					"parent":     {{ID: "parent-999"}},
+					"project":    {{ID: "project-888"}},
+					"team":       {{ID: "team-777"}},
+					"department": {{ID: "dept-666"}},
+					"region":     {{ID: "region-555"}},
 				},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have: 1 public + 5 references + 15 relations = 21 tuples
 					return len(req.Writes) == 21 && len(req.Deletes) == 0
@@ -422,13 +477,13 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 					"writer": {"user:special@example.com", "user:test_user.123"},
 					"viewer": {"user:another+user@domain.org"},
 				},
-				References: map[string]string{
-					"parent": "parent-with_special.chars-789",
+				References: map[string]referenceList{
+					"parent": {{ID: "parent-with_special.chars-789"}},
 				},
 			},
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req client.ClientWriteRequest) bool {
 					// Should have: 1 parent + 3 relations = 4 tuples (no public)
 					return len(req.Writes) == 4 && len(req.Deletes) == 0
@@ -452,7 +507,7 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.processStandardAccessUpdate(msg, tt.obj)
+				err := handlerService.processStandardAccessUpdate(context.Background(), msg, tt.obj)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -473,3 +528,352 @@ func TestProcessStandardAccessUpdate(t *testing.T) {
 		})
 	}
 }
+
+// TestDryRunSubject tests the mapping of update and delete subjects to their
+// dry-run variants.
+func TestDryRunSubject(t *testing.T) {
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{subject: "lfx.update_access.project", expected: "lfx.update_access_dryrun.project"},
+		{subject: "lfx.delete_all_access.groupsio_service", expected: "lfx.delete_all_access_dryrun.groupsio_service"},
+		{subject: "lfx.access_check.request", expected: ""},
+		{subject: "lfx.put_registrant.meeting", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			assert.Equal(t, tt.expected, dryRunSubject(tt.subject))
+		})
+	}
+}
+
+// TestDryRunHeader tests that the relation, member and registrant subjects,
+// which have no dry-run variant, reply with the planned tuples without writing
+// to OpenFGA when the message has the dry-run header.
+func TestDryRunHeader(t *testing.T) {
+	tests := []struct {
+		name            string
+		subject         string
+		messageData     []byte
+		existing        []openfga.Tuple
+		handler         func(*HandlerService, context.Context, INatsMsg) error
+		expectedObject  string
+		expectedWrites  int
+		expectedDeletes int
+	}{
+		{
+			name:    "add relation",
+			subject: "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"writer": {"alice", "carol"}},
+			}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "committee:committee-123"}},
+			},
+			handler:        (*HandlerService).addRelationHandler,
+			expectedObject: "committee:committee-123",
+			expectedWrites: 1,
+		},
+		{
+			name:    "remove relation",
+			subject: "lfx.remove_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"writer": {"alice"}},
+			}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "committee:committee-123"}},
+			},
+			handler:         (*HandlerService).removeRelationHandler,
+			expectedObject:  "committee:committee-123",
+			expectedDeletes: 1,
+		},
+		{
+			name:           "put member",
+			subject:        "lfx.put_member.team",
+			messageData:    mustJSON(memberStub{Username: "bob", TeamUID: "team-123"}),
+			handler:        (*HandlerService).teamMemberPutHandler,
+			expectedObject: "team:team-123",
+			expectedWrites: 1,
+		},
+		{
+			name:        "remove member",
+			subject:     "lfx.remove_member.team",
+			messageData: mustJSON(memberStub{Username: "alice", TeamUID: "team-123"}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:alice", Relation: "member", Object: "team:team-123"}},
+			},
+			handler:         (*HandlerService).teamMemberRemoveHandler,
+			expectedObject:  "team:team-123",
+			expectedDeletes: 1,
+		},
+		{
+			name:        "put registrant",
+			subject:     "lfx.put_registrant.meeting",
+			messageData: mustJSON(registrantStub{Username: "bob", MeetingUID: "meeting-1", Host: true}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:bob", Relation: "participant", Object: "meeting:meeting-1"}},
+			},
+			handler:         (*HandlerService).meetingRegistrantPutHandler,
+			expectedObject:  "meeting:meeting-1",
+			expectedWrites:  1,
+			expectedDeletes: 1,
+		},
+		{
+			name:    "remove registrants in bulk",
+			subject: "lfx.remove_registrant.meeting",
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+				{Username: "bob", MeetingUID: "meeting-1"},
+			}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:alice", Relation: "host", Object: "meeting:meeting-1"}},
+				{Key: openfga.TupleKey{User: "user:bob", Relation: "participant", Object: "meeting:meeting-1"}},
+			},
+			handler:         (*HandlerService).meetingRegistrantRemoveHandler,
+			expectedObject:  "meeting:meeting-1",
+			expectedDeletes: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			msg.subject = tt.subject
+			msg.header = nats.Header{"Dry-Run": {"true"}}
+
+			handlerService := setupService()
+			fgaClient := handlerService.fgaService.client.(*MockFgaClient)
+			fgaClient.On("Read", mock.Anything, mock.Anything, mock.Anything).
+				Return(&client.ClientReadResponse{Tuples: tt.existing}, nil).Once()
+
+			var reply syncResult
+			msg.On("Respond", mock.Anything).Run(func(args mock.Arguments) {
+				assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+			}).Return(nil).Once()
+
+			assert.NoError(t, tt.handler(handlerService, context.Background(), msg))
+
+			msg.AssertExpectations(t)
+			fgaClient.AssertNotCalled(t, "Write", mock.Anything, mock.Anything)
+			assert.Nil(t, reply.Error)
+			assert.True(t, reply.DryRun)
+			assert.Equal(t, tt.expectedObject, reply.Object)
+			assert.Len(t, reply.Writes, tt.expectedWrites)
+			assert.Len(t, reply.Deletes, tt.expectedDeletes)
+		})
+	}
+}
+
+// TestReplySync tests the structured reply sent for update and delete requests.
+func TestReplySync(t *testing.T) {
+	tests := []struct {
+		name          string
+		replySubject  string
+		result        *syncResult
+		handlerErr    error
+		respondErr    error
+		expectedReply *syncResult
+		expectedError error
+	}{
+		{
+			name:         "success reply with applied diff",
+			replySubject: "reply.subject",
+			result: &syncResult{
+				Object: "project:123",
+				Writes: []client.ClientTupleKey{{User: "user:1", Relation: "writer", Object: "project:123"}},
+			},
+			expectedReply: &syncResult{
+				Object:  "project:123",
+				Writes:  []client.ClientTupleKey{{User: "user:1", Relation: "writer", Object: "project:123"}},
+				Deletes: []client.ClientTupleKeyWithoutCondition{},
+			},
+		},
+		{
+			name:          "error reply with code",
+			replySubject:  "reply.subject",
+			handlerErr:    newHandlerError(errCodeMissingUID, errors.New("project ID not found")),
+			expectedError: errors.New("project ID not found"),
+			expectedReply: &syncResult{
+				Writes:  []client.ClientTupleKey{},
+				Deletes: []client.ClientTupleKeyWithoutCondition{},
+				Error:   &replyError{Code: errCodeMissingUID, Message: "project ID not found"},
+			},
+		},
+		{
+			name:          "untyped error is reported as internal",
+			replySubject:  "reply.subject",
+			handlerErr:    errors.New("boom"),
+			expectedError: errors.New("boom"),
+			expectedReply: &syncResult{
+				Writes:  []client.ClientTupleKey{},
+				Deletes: []client.ClientTupleKeyWithoutCondition{},
+				Error:   &replyError{Code: errCodeInternal, Message: "boom"},
+			},
+		},
+		{
+			name:          "handler error takes precedence over respond error",
+			replySubject:  "reply.subject",
+			handlerErr:    errors.New("boom"),
+			respondErr:    errors.New("respond failed"),
+			expectedError: errors.New("boom"),
+		},
+		{
+			name:          "no inbox - no reply",
+			handlerErr:    errors.New("boom"),
+			expectedError: errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(nil)
+			msg.reply = tt.replySubject
+
+			var reply syncResult
+			if tt.replySubject != "" {
+				msg.On("Respond", mock.Anything).Run(func(args mock.Arguments) {
+					assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+				}).Return(tt.respondErr).Once()
+			}
+
+			handlerService := setupService()
+			err := handlerService.replySync(context.Background(), msg, time.Now(), tt.result, tt.handlerErr)
+			if tt.expectedError != nil {
+				assert.EqualError(t, err, tt.expectedError.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tt.replySubject == "" {
+				msg.AssertNotCalled(t, "Respond")
+				return
+			}
+			msg.AssertExpectations(t)
+			if tt.expectedReply != nil {
+				// The elapsed time is not deterministic.
+				reply.ElapsedMs = 0
+				assert.Equal(t, *tt.expectedReply, reply)
+			}
+		})
+	}
+}
+
+// TestPrincipalUser tests the conversion of payload principals to OpenFGA users.
+func TestPrincipalUser(t *testing.T) {
+	tests := []struct {
+		principal string
+		expected  string
+	}{
+		{principal: "alice", expected: "user:alice"},
+		{principal: "user:alice", expected: "user:alice"},
+		{principal: "user:*", expected: "user:*"},
+		{principal: "team:abc#member", expected: "team:abc#member"},
+		{principal: "committee:xyz#member", expected: "committee:xyz#member"},
+		{principal: "team:abc", expected: "team:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			assert.Equal(t, tt.expected, principalUser(tt.principal))
+		})
+	}
+}
+
+// TestReferenceListUnmarshalJSON tests the accepted formats of references
+func TestReferenceListUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expected      referenceList
+		expectedError bool
+	}{
+		{
+			name:     "single ID",
+			data:     `"project-123"`,
+			expected: referenceList{{ID: "project-123"}},
+		},
+		{
+			name:     "list of IDs",
+			data:     `["committee-1", "committee-2"]`,
+			expected: referenceList{{ID: "committee-1"}, {ID: "committee-2"}},
+		},
+		{
+			name:     "typed reference",
+			data:     `{"type": "committee", "id": "committee-1"}`,
+			expected: referenceList{{Type: "committee", ID: "committee-1"}},
+		},
+		{
+			name:     "mixed list",
+			data:     `["project-123", {"type": "committee", "id": "committee-1"}]`,
+			expected: referenceList{{ID: "project-123"}, {Type: "committee", ID: "committee-1"}},
+		},
+		{
+			name:     "empty list",
+			data:     `[]`,
+			expected: referenceList{},
+		},
+		{
+			name:          "empty ID",
+			data:          `""`,
+			expectedError: true,
+		},
+		{
+			name:          "typed reference without ID",
+			data:          `{"type": "committee"}`,
+			expectedError: true,
+		},
+		{
+			name:          "unsupported value",
+			data:          `123`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refs referenceList
+			err := json.Unmarshal([]byte(tt.data), &refs)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, refs)
+		})
+	}
+}
+
+// TestBuildStandardAccessTuplesReferences tests the tuples built for lists of
+// references and typed references
+func TestBuildStandardAccessTuplesReferences(t *testing.T) {
+	obj := new(standardAccessStub)
+	err := json.Unmarshal([]byte(`{
+		"uid": "meeting-123",
+		"object_type": "survey",
+		"references": {
+			"project": "project-456",
+			"committee": ["committee-1", {"type": "committee", "id": "committee-2"}],
+			"parent": {"type": "meeting", "id": "meeting-789"}
+		}
+	}`), obj)
+	assert.NoError(t, err)
+
+	handlerService := setupService()
+	tuples := handlerService.buildStandardAccessTuples("survey:meeting-123", obj)
+
+	var users []string
+	for _, tuple := range tuples {
+		users = append(users, tuple.Relation+"@"+tuple.User)
+	}
+	assert.ElementsMatch(t, []string{
+		"project@project:project-456",
+		"committee@committee:committee-1",
+		"committee@committee:committee-2",
+		"parent@meeting:meeting-789",
+	}, users)
+}
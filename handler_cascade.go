@@ -0,0 +1,163 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	"github.com/openfga/go-sdk/client"
+)
+
+// Cascade modes for deleting all access of an object.
+const (
+	// cascadeOff only deletes the tuples of the deleted object itself.
+	cascadeOff = "off"
+	// cascadeReport finds the tuples referencing the deleted object and reports
+	// them in the reply, without deleting them.
+	cascadeReport = "report"
+	// cascadeRemove deletes the tuples referencing the deleted object, and the
+	// access of its child objects.
+	cascadeRemove = "remove"
+)
+
+var (
+	// cascadeMode is the cascade mode used when deleting all access of an object.
+	cascadeMode = cascadeOff
+	// cascadeDepth is the number of levels of referencing tuples that are
+	// followed. Child objects are deleted between levels, so a depth of 1 only
+	// cleans up the references to the deleted object itself.
+	cascadeDepth = 1
+	// cascadeChildRelations are the relations through which a referencing object
+	// is a child of the referenced object, and is therefore deleted with it.
+	cascadeChildRelations = []string{constants.RelationParent, constants.RelationProject}
+)
+
+// cascadeResult is the cascade section of a delete reply.
+type cascadeResult struct {
+	Mode string `json:"mode"`
+	// References are the tuples that referenced a deleted object.
+	References []client.ClientTupleKeyWithoutCondition `json:"references"`
+	// Objects are the child objects whose access was deleted with the object.
+	Objects []string `json:"objects"`
+}
+
+// loadCascadeConfig reads the cascade configuration from the environment.
+func loadCascadeConfig() error {
+	if mode := os.Getenv("DELETE_CASCADE_MODE"); mode != "" {
+		switch mode {
+		case cascadeOff, cascadeReport, cascadeRemove:
+			cascadeMode = mode
+		default:
+			return fmt.Errorf("invalid DELETE_CASCADE_MODE %q", mode)
+		}
+	}
+	if depth := os.Getenv("DELETE_CASCADE_DEPTH"); depth != "" {
+		value, err := strconv.Atoi(depth)
+		if err != nil || value < 1 {
+			return fmt.Errorf("invalid DELETE_CASCADE_DEPTH %q", depth)
+		}
+		cascadeDepth = value
+	}
+	if relations := os.Getenv("DELETE_CASCADE_RELATIONS"); relations != "" {
+		cascadeChildRelations = strings.Split(relations, ",")
+	}
+	return nil
+}
+
+// isCascadeChildRelation reports whether a referencing tuple with the given
+// relation makes its object a child of the referenced object.
+func isCascadeChildRelation(relation string) bool {
+	for _, childRelation := range cascadeChildRelations {
+		if relation == childRelation {
+			return true
+		}
+	}
+	return false
+}
+
+// cascadeDelete finds the tuples where a deleted object is the user, such as a
+// child project's parent or a meeting's project, and depending on the cascade
+// mode either reports or removes them. Dry-run requests never remove anything.
+func (h *HandlerService) cascadeDelete(ctx context.Context, message INatsMsg, object string) (*cascadeResult, error) {
+	mode := cascadeMode
+	if mode == cascadeRemove && isDryRun(message) {
+		mode = cascadeReport
+	}
+	result := &cascadeResult{
+		Mode:       mode,
+		References: []client.ClientTupleKeyWithoutCondition{},
+		Objects:    []string{},
+	}
+
+	parents := []string{object}
+	seen := map[string]bool{object: true}
+	for level := 1; level <= cascadeDepth && len(parents) > 0; level++ {
+		var children []string
+		for _, parent := range parents {
+			// Only the object types and usersets that the authorization model
+			// allows to reference the parent are searched, as OpenFGA rejects
+			// reads of undefined types.
+			parentType, _, _ := strings.Cut(parent, ":")
+			var references []client.ClientTupleKeyWithoutCondition
+			for _, ref := range authzModel.references(parentType) {
+				user := parent
+				if ref.userRelation != "" {
+					user += "#" + ref.userRelation
+				}
+				tuples, err := h.fgaService.ReadUserTuples(ctx, user, ref.objectType+":")
+				if err != nil {
+					return result, err
+				}
+				for _, tuple := range tuples {
+					references = append(
+						references,
+						h.fgaService.TupleKeyWithoutCondition(tuple.Key.User, tuple.Key.Relation, tuple.Key.Object),
+					)
+					// Only a direct reference makes the object a child.
+					if user == parent && isCascadeChildRelation(tuple.Key.Relation) && !seen[tuple.Key.Object] {
+						seen[tuple.Key.Object] = true
+						children = append(children, tuple.Key.Object)
+					}
+				}
+			}
+			result.References = append(result.References, references...)
+
+			if mode == cascadeRemove && len(references) > 0 {
+				if err := h.fgaService.DeleteTuples(ctx, references); err != nil {
+					return result, err
+				}
+			}
+		}
+
+		// Children found at the last level keep their access.
+		if level == cascadeDepth {
+			break
+		}
+		for _, child := range children {
+			result.Objects = append(result.Objects, child)
+			if mode == cascadeRemove {
+				if _, _, err := h.fgaService.SyncObjectTuples(ctx, child, nil); err != nil {
+					return result, err
+				}
+			}
+		}
+		parents = children
+	}
+
+	logger.With(
+		"object", object,
+		"mode", mode,
+		"depth", cascadeDepth,
+		"references", result.References,
+		"objects", result.Objects,
+	).InfoContext(ctx, "cascaded access deletion")
+
+	return result, nil
+}
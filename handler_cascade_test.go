@@ -0,0 +1,206 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// userRead matches a read request for the tuples where the user is the given
+// object, on objects of the given type.
+func userRead(user, objectType string) any {
+	return mock.MatchedBy(func(req ClientReadRequest) bool {
+		return req.User != nil && *req.User == user && req.Object != nil && *req.Object == objectType
+	})
+}
+
+// objectRead matches a read request for the tuples of the given object.
+func objectRead(object string) any {
+	return mock.MatchedBy(func(req ClientReadRequest) bool {
+		return req.User == nil && req.Object != nil && *req.Object == object
+	})
+}
+
+// cascadeTestModel returns an authorization model where projects are referenced
+// by child projects and meetings, and committee members by meetings.
+func cascadeTestModel() authModel {
+	return authModel{
+		"user":      {},
+		"project":   {"parent": {{Type: "project"}}, "writer": {{Type: "user"}}},
+		"committee": {"project": {{Type: "project"}}, "member": {{Type: "user"}}},
+		"meeting": {
+			"project":   {{Type: "project"}},
+			"committee": {{Type: "project"}, {Type: "committee", Relation: openfga.PtrString("member")}},
+			"viewer":    {{Type: "user"}, {Type: "user", Wildcard: &map[string]interface{}{}}},
+		},
+	}
+}
+
+// TestCascadeDelete tests the cascade of project access deletion to the tuples
+// and child objects referencing the project.
+func TestCascadeDelete(t *testing.T) {
+	childRef := openfga.Tuple{Key: openfga.TupleKey{User: "project:parent", Relation: "parent", Object: "project:child"}}
+	meetingRef := openfga.Tuple{Key: openfga.TupleKey{User: "project:child", Relation: "project", Object: "meeting:m1"}}
+	committeeRef := openfga.Tuple{Key: openfga.TupleKey{User: "project:parent", Relation: "committee", Object: "meeting:m2"}}
+
+	tests := []struct {
+		name               string
+		mode               string
+		depth              int
+		subject            string
+		setupMocks         func(*MockFgaClient)
+		expectedReferences int
+		expectedObjects    []string
+	}{
+		{
+			name:    "report lists references without removing them",
+			mode:    cascadeReport,
+			depth:   1,
+			subject: "lfx.delete_all_access.project",
+			setupMocks: func(fgaClient *MockFgaClient) {
+				fgaClient.On("Read", mock.Anything, userRead("project:parent", "project:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{childRef}}, nil).Once()
+				fgaClient.On("Read", mock.Anything, userRead("project:parent", "meeting:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{committeeRef}}, nil).Once()
+			},
+			expectedReferences: 2,
+			expectedObjects:    []string{},
+		},
+		{
+			name:    "remove deletes references and child objects",
+			mode:    cascadeRemove,
+			depth:   2,
+			subject: "lfx.delete_all_access.project",
+			setupMocks: func(fgaClient *MockFgaClient) {
+				fgaClient.On("Read", mock.Anything, userRead("project:parent", "project:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{childRef}}, nil).Once()
+				fgaClient.On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].Object == "project:child"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				// The child project is deleted with its parent.
+				fgaClient.On("Read", mock.Anything, objectRead("project:child"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "project:child"}},
+					}}, nil).Once()
+				fgaClient.On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:alice"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				// The references to the child are cleaned up at the second level.
+				fgaClient.On("Read", mock.Anything, userRead("project:child", "meeting:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{meetingRef}}, nil).Once()
+				fgaClient.On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].Object == "meeting:m1"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedReferences: 2,
+			expectedObjects:    []string{"project:child"},
+		},
+		{
+			name:    "dry run only reports",
+			mode:    cascadeRemove,
+			depth:   2,
+			subject: "lfx.delete_all_access_dryrun.project",
+			setupMocks: func(fgaClient *MockFgaClient) {
+				fgaClient.On("Read", mock.Anything, userRead("project:parent", "project:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{childRef}}, nil).Once()
+				fgaClient.On("Read", mock.Anything, userRead("project:child", "meeting:"), mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{meetingRef}}, nil).Once()
+			},
+			expectedReferences: 2,
+			expectedObjects:    []string{"project:child"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousMode, previousDepth, previousModel := cascadeMode, cascadeDepth, authzModel
+			cascadeMode, cascadeDepth, authzModel = tt.mode, tt.depth, cascadeTestModel()
+			t.Cleanup(func() {
+				cascadeMode, cascadeDepth, authzModel = previousMode, previousDepth, previousModel
+			})
+
+			msg := CreateMockNatsMsg([]byte("parent"))
+			msg.reply = "reply.subject"
+			msg.subject = tt.subject
+
+			handlerService := setupService()
+			fgaClient := handlerService.fgaService.client.(*MockFgaClient)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			// The deleted project has no tuples of its own.
+			fgaClient.On("Read", mock.Anything, objectRead("project:parent"), mock.Anything).
+				Return(&ClientReadResponse{}, nil).Once()
+			tt.setupMocks(fgaClient)
+			// Any other object type has no references.
+			fgaClient.On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{}, nil)
+
+			var reply syncResult
+			msg.On("Respond", mock.Anything).Run(func(args mock.Arguments) {
+				assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+			}).Return(nil).Once()
+
+			assert.NoError(t, handlerService.projectDeleteAllAccessHandler(context.Background(), msg))
+
+			fgaClient.AssertExpectations(t)
+			// Types and usersets that cannot reference a project are not searched.
+			fgaClient.AssertNotCalled(t, "Read", mock.Anything, userRead("project:parent", "user:"), mock.Anything)
+			fgaClient.AssertNotCalled(t, "Read", mock.Anything, userRead("project:parent#member", "meeting:"), mock.Anything)
+			if tt.mode != cascadeRemove || tt.subject != "lfx.delete_all_access.project" {
+				fgaClient.AssertNotCalled(t, "Write", mock.Anything, mock.Anything)
+			}
+			if assert.NotNil(t, reply.Cascade) {
+				assert.Len(t, reply.Cascade.References, tt.expectedReferences)
+				assert.Equal(t, tt.expectedObjects, reply.Cascade.Objects)
+			}
+		})
+	}
+}
+
+// TestCascadeDeleteFailure tests that a failed cascade fails the deletion, so
+// that it is retried, after the tuples of the object were deleted.
+func TestCascadeDeleteFailure(t *testing.T) {
+	previousMode, previousModel := cascadeMode, authzModel
+	cascadeMode, authzModel = cascadeRemove, cascadeTestModel()
+	t.Cleanup(func() {
+		cascadeMode, authzModel = previousMode, previousModel
+	})
+
+	msg := CreateMockNatsMsg([]byte("parent"))
+	msg.reply = "reply.subject"
+	msg.subject = "lfx.delete_all_access.project"
+
+	handlerService := setupService()
+	fgaClient := handlerService.fgaService.client.(*MockFgaClient)
+	fgaClient.On("Read", mock.Anything, objectRead("project:parent"), mock.Anything).
+		Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+			{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "project:parent"}},
+		}}, nil).Once()
+	fgaClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Once()
+	fgaClient.On("Read", mock.Anything, userRead("project:parent", "committee:"), mock.Anything).
+		Return((*ClientReadResponse)(nil), errors.New("type not found")).Once()
+
+	var reply syncResult
+	msg.On("Respond", mock.Anything).Run(func(args mock.Arguments) {
+		assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+	}).Return(nil).Once()
+
+	err := handlerService.projectDeleteAllAccessHandler(context.Background(), msg)
+	assert.Error(t, err)
+	assert.Equal(t, errCodeUpstream, errorCode(err))
+
+	fgaClient.AssertExpectations(t)
+	assert.Len(t, reply.Deletes, 1)
+	assert.NotNil(t, reply.Cascade)
+	if assert.NotNil(t, reply.Error) {
+		assert.Equal(t, errCodeUpstream, reply.Error.Code)
+	}
+}
@@ -6,98 +6,33 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
 
 	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
 )
 
-type committeeStub struct {
-	UID        string              `json:"uid"`
-	ObjectType string              `json:"object_type"`
-	Public     bool                `json:"public"`
-	Relations  map[string][]string `json:"relations"`
-	References map[string]string   `json:"references"`
+// committeeMembers describes the members of a committee. A member has a single
+// role, so changing the role of a member swaps its relation.
+var committeeMembers = memberType{
+	name:       "committee",
+	objectType: constants.ObjectTypeCommittee,
+	relations:  []string{constants.RelationMember, constants.RelationChair, constants.RelationObserver},
+	exclusive:  true,
+	roles: map[string]string{
+		"chair":    constants.RelationChair,
+		"member":   constants.RelationMember,
+		"observer": constants.RelationObserver,
+	},
+	uid: func(member *memberStub) string { return member.CommitteeUID },
 }
 
-// committeeUpdateAccessHandler handles committee access control updates.
-func (h *HandlerService) committeeUpdateAccessHandler(message INatsMsg) error {
-	ctx := context.Background()
-
-	logger.With("message", string(message.Data())).InfoContext(ctx, "handling committee access control update")
-
-	// Parse the event data.
-	committee := new(committeeStub)
-	var err error
-	err = json.Unmarshal(message.Data(), committee)
-	if err != nil {
-		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
-		return err
-	}
-
-	if committee.UID == "" {
-		logger.ErrorContext(ctx, "committee ID not found")
-		return errors.New("committee ID not found")
-	}
-
-	object := fmt.Sprintf("%s:%s", committee.ObjectType, committee.UID)
-
-	// Build a list of tuples to sync.
-	tuples := h.fgaService.NewTupleKeySlice(4)
-
-	// Convert the "public" attribute to a "user:*" relation.
-	if committee.Public {
-		tuples = append(tuples, h.fgaService.TupleKey(constants.UserWildcard, constants.RelationViewer, object))
-	}
-
-	// for parent relation, project relation, etc
-	for reference, value := range committee.References {
-		refType := reference
-		if reference == constants.RelationParent {
-			refType = committee.ObjectType
-		}
-
-		key := fmt.Sprintf("%s:%s", refType, value)
-		tuples = append(tuples, h.fgaService.TupleKey(key, reference, object))
-	}
-
-	// Add each principal from the object as the corresponding relationship tuple
-	// (as defined in the OpenFGA schema).
-	// for writer, auditor etc
-	for relation, principals := range committee.Relations {
-		for _, principal := range principals {
-			tuples = append(tuples, h.fgaService.TupleKey(constants.ObjectTypeUser+principal, relation, object))
-		}
-	}
-
-	tuplesWrites, tuplesDeletes, err := h.fgaService.SyncObjectTuples(ctx, object, tuples)
-	if err != nil {
-		logger.With(errKey, err, "tuples", tuples, "object", object).ErrorContext(ctx, "failed to sync tuples")
-		return err
-	}
-
-	logger.With(
-		"tuples", tuples,
-		"object", object,
-		"writes", tuplesWrites,
-		"deletes", tuplesDeletes,
-	).InfoContext(ctx, "synced tuples")
-
-	if message.Reply() != "" {
-		// Send a reply if an inbox was provided.
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
-		}
-
-		logger.With("object", object).InfoContext(ctx, "sent project access control update response")
-	}
-
-	return nil
+// committeeMemberPutHandler handles putting a member to a committee, or
+// changing the role of an existing member (idempotent create).
+func (h *HandlerService) committeeMemberPutHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, committeeMembers, memberPut)
 }
 
-// committeeDeleteAllAccessHandler handles committee access control deletions.
-func (h *HandlerService) committeeDeleteAllAccessHandler(message INatsMsg) error {
-	return h.processDeleteAllAccessMessage(message, constants.ObjectTypeCommittee, "committee")
+// committeeMemberRemoveHandler handles removing a member from a committee,
+// whatever their role.
+func (h *HandlerService) committeeMemberRemoveHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, committeeMembers, memberRemove)
 }
@@ -0,0 +1,146 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestCommitteeMemberHandlers tests the committeeMemberPutHandler and
+// committeeMemberRemoveHandler functions
+func TestCommitteeMemberHandlers(t *testing.T) {
+	existing := []openfga.Tuple{
+		{Key: openfga.TupleKey{User: "user:alice", Relation: "member", Object: "committee:committee-123"}},
+		{Key: openfga.TupleKey{User: "user:bob", Relation: "chair", Object: "committee:committee-123"}},
+		{Key: openfga.TupleKey{User: "user:bob", Relation: "writer", Object: "committee:committee-123"}},
+	}
+
+	tests := []struct {
+		name          string
+		messageData   []byte
+		operation     memberOperation
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name:        "put new member with the default role",
+			messageData: mustJSON(memberStub{Username: "carol", CommitteeUID: "committee-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:carol" && req.Writes[0].Relation == "member"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "role change swaps relations in one write",
+			messageData: mustJSON(memberStub{Username: "alice", Role: "chair", CommitteeUID: "committee-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 1 &&
+						req.Writes[0].User == "user:alice" && req.Writes[0].Relation == "chair" &&
+						req.Deletes[0].User == "user:alice" && req.Deletes[0].Relation == "member"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "put with the same role is a no-op",
+			messageData: mustJSON(memberStub{Username: "bob", Role: "chair", CommitteeUID: "committee-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				// No Write operation expected.
+			},
+		},
+		{
+			name:        "remove deletes any role and keeps other relations",
+			messageData: mustJSON(memberStub{Username: "bob", CommitteeUID: "committee-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 &&
+						req.Deletes[0].User == "user:bob" && req.Deletes[0].Relation == "chair"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "unsupported role",
+			messageData: mustJSON(memberStub{Username: "alice", Role: "secretary", CommitteeUID: "committee-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing committee UID",
+			messageData: mustJSON(memberStub{Username: "alice", Role: "member"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "write operation fails",
+			messageData: mustJSON(memberStub{Username: "alice", Role: "observer", CommitteeUID: "committee-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), assert.AnError).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			var err error
+			if tt.operation == memberRemove {
+				msg.subject = "lfx.remove_member.committee"
+				err = handlerService.committeeMemberRemoveHandler(context.Background(), msg)
+			} else {
+				msg.subject = "lfx.put_member.committee"
+				err = handlerService.committeeMemberPutHandler(context.Background(), msg)
+			}
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+)
+
+// handlerShutdownTimeout is how long the messages being handled when the
+// service shuts down have to finish before their calls are canceled.
+const handlerShutdownTimeout = 15 * time.Second
+
+var (
+	// handlersCtx is the parent context of every handler, canceled when the
+	// service shuts down.
+	handlersCtx, cancelHandlers = context.WithCancel(context.Background())
+	// checkTimeout is the default deadline of the request/reply subjects:
+	// access checks, dry runs and the dead-letter admin subjects.
+	checkTimeout = 5 * time.Second
+	// updateTimeout is the default deadline of the update and delete subjects.
+	updateTimeout = 25 * time.Second
+)
+
+// loadTimeoutConfig loads the default handler deadlines of the check and
+// update subjects from the environment.
+func loadTimeoutConfig() error {
+	for name, target := range map[string]*time.Duration{
+		"CHECK_TIMEOUT":  &checkTimeout,
+		"UPDATE_TIMEOUT": &updateTimeout,
+	} {
+		if duration := os.Getenv(name); duration != "" {
+			value, err := time.ParseDuration(duration)
+			if err != nil || value <= 0 {
+				return fmt.Errorf("invalid %s %q", name, duration)
+			}
+			*target = value
+		}
+	}
+	// A stream message still being handled after its ack wait is redelivered.
+	// The ack wait starts again when a worker picks the message up, as it is
+	// reported in progress while it waits, and so does the deadline.
+	if useJetStream && updateTimeout >= jetstreamAckWait {
+		return fmt.Errorf("UPDATE_TIMEOUT %s must be shorter than the JetStream ack wait %s", updateTimeout, jetstreamAckWait)
+	}
+	return nil
+}
+
+// subjectTimeout returns the default handler deadline of a subject.
+func subjectTimeout(subject string) time.Duration {
+	if isSyncSubject(subject) {
+		return updateTimeout
+	}
+	return checkTimeout
+}
+
+// handlerContext returns the context of a message received at receivedAt,
+// whose log lines carry the subject and the request headers of the message.
+// Its deadline is the timeout of the subject, or the shorter timeout carried
+// in the request timeout header, so that a request is no longer worked on
+// once the caller stopped waiting for the reply. The header is ignored for
+// messages without a reply inbox, such as stream messages, whose publishers
+// are not waiting.
+func handlerContext(message INatsMsg, receivedAt time.Time) (context.Context, context.CancelFunc) {
+	ctx := withLogAttrs(handlersCtx, messageLogAttrs(message)...)
+	timeout := subjectTimeout(message.Subject())
+	if value := headerValue(message.Header(), constants.RequestTimeoutHeader); value != "" && message.Reply() != "" {
+		requestTimeout, err := time.ParseDuration(value)
+		if err == nil && requestTimeout > 0 {
+			timeout = min(timeout, requestTimeout)
+		} else {
+			logger.With("timeout", value).WarnContext(ctx, "ignoring invalid request timeout header")
+		}
+	}
+	return context.WithDeadline(ctx, receivedAt.Add(timeout))
+}
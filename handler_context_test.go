@@ -0,0 +1,92 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHandlerContext tests the deadlines of the handler contexts
+func TestHandlerContext(t *testing.T) {
+	receivedAt := time.Now()
+	check, update := constants.AccessCheckSubject, constants.ProjectUpdateAccessSubject
+
+	tests := []struct {
+		name    string
+		subject string
+		reply   string
+		timeout string
+		want    time.Duration
+	}{
+		{name: "check default", subject: check, want: checkTimeout},
+		{name: "update default", subject: update, want: updateTimeout},
+		{name: "shorter request timeout", subject: check, reply: "inbox", timeout: "500ms", want: 500 * time.Millisecond},
+		{name: "longer request timeout", subject: check, reply: "inbox", timeout: "1h", want: checkTimeout},
+		{name: "invalid request timeout", subject: update, reply: "inbox", timeout: "soon", want: updateTimeout},
+		{name: "negative request timeout", subject: update, reply: "inbox", timeout: "-1s", want: updateTimeout},
+		{name: "no reply inbox", subject: update, timeout: "1s", want: updateTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(nil)
+			msg.subject = tt.subject
+			msg.reply = tt.reply
+			if tt.timeout != "" {
+				msg.header = nats.Header{constants.RequestTimeoutHeader: {tt.timeout}}
+			}
+			ctx, cancel := handlerContext(msg, receivedAt)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			assert.True(t, ok)
+			assert.Equal(t, receivedAt.Add(tt.want), deadline)
+		})
+	}
+}
+
+// TestHandlerContextCanceled tests that handler contexts are canceled with the
+// service.
+func TestHandlerContextCanceled(t *testing.T) {
+	savedCtx, savedCancel := handlersCtx, cancelHandlers
+	defer func() { handlersCtx, cancelHandlers = savedCtx, savedCancel }()
+	handlersCtx, cancelHandlers = context.WithCancel(context.Background())
+
+	msg := CreateMockNatsMsg(nil)
+	msg.subject = constants.ProjectUpdateAccessSubject
+	ctx, cancel := handlerContext(msg, time.Now())
+	defer cancel()
+	assert.NoError(t, ctx.Err())
+
+	cancelHandlers()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+// TestLoadTimeoutConfig tests the loadTimeoutConfig function
+func TestLoadTimeoutConfig(t *testing.T) {
+	savedCheck, savedUpdate, savedJetStream := checkTimeout, updateTimeout, useJetStream
+	defer func() { checkTimeout, updateTimeout, useJetStream = savedCheck, savedUpdate, savedJetStream }()
+	useJetStream = true
+
+	t.Setenv("CHECK_TIMEOUT", "2s")
+	t.Setenv("UPDATE_TIMEOUT", "20s")
+	assert.NoError(t, loadTimeoutConfig())
+	assert.Equal(t, 2*time.Second, checkTimeout)
+	assert.Equal(t, 20*time.Second, updateTimeout)
+
+	t.Setenv("UPDATE_TIMEOUT", "0s")
+	assert.Error(t, loadTimeoutConfig())
+
+	// Updates must finish within the ack wait of the stream.
+	t.Setenv("UPDATE_TIMEOUT", "1m")
+	assert.Error(t, loadTimeoutConfig())
+	useJetStream = false
+	assert.NoError(t, loadTimeoutConfig())
+}
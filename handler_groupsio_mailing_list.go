@@ -0,0 +1,32 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+)
+
+// mailingListMembers describes the subscribers and moderators of a groups.io
+// mailing list.
+var mailingListMembers = memberType{
+	name:       "mailing list",
+	objectType: constants.ObjectTypeGroupsIOMailingList,
+	relations:  []string{constants.RelationSubscriber, constants.RelationModerator},
+	uid:        func(member *memberStub) string { return member.MailingListUID },
+}
+
+// mailingListMemberPutHandler handles putting a subscriber or moderator to a
+// groups.io mailing list (idempotent create).
+func (h *HandlerService) mailingListMemberPutHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, mailingListMembers, memberPut)
+}
+
+// mailingListMemberRemoveHandler handles removing a subscriber or moderator
+// from a groups.io mailing list.
+func (h *HandlerService) mailingListMemberRemoveHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, mailingListMembers, memberRemove)
+}
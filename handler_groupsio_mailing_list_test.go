@@ -0,0 +1,169 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMailingListUpdateAccessHandler tests the registered handler of the
+// groups.io mailing list object type
+func TestMailingListUpdateAccessHandler(t *testing.T) {
+	msg := CreateMockNatsMsg(mustJSON(standardAccessStub{
+		UID:        "list-123",
+		References: map[string]referenceList{"parent": {{ID: "service-456"}}},
+		Relations:  map[string][]string{"writer": {"alice"}},
+	}))
+	msg.reply = "reply.subject"
+	msg.subject = "lfx.update_access.groupsio_mailing_list"
+	msg.On("Respond", successReply()).Return(nil).Once()
+
+	handlerService := setupService()
+	handlerService.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+		Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+			{Key: openfga.TupleKey{User: "user:bob", Relation: "subscriber", Object: "groupsio_mailing_list:list-123"}},
+			{Key: openfga.TupleKey{User: "user:carol", Relation: "moderator", Object: "groupsio_mailing_list:list-123"}},
+		}}, nil).Once()
+	handlerService.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+		// Subscribers and moderators are kept.
+		if len(req.Writes) != 2 || len(req.Deletes) != 0 {
+			return false
+		}
+		for _, tuple := range req.Writes {
+			if tuple.Relation == "parent" && tuple.User != "groupsio_service:service-456" {
+				return false
+			}
+		}
+		return true
+	})).Return(&ClientWriteResponse{}, nil).Once()
+	handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+	err := handlerService.updateAccessHandler("groupsio_mailing_list")(context.Background(), msg)
+	assert.NoError(t, err)
+
+	msg.AssertExpectations(t)
+	handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+}
+
+// TestMailingListMemberHandlers tests the mailingListMemberPutHandler and
+// mailingListMemberRemoveHandler functions
+func TestMailingListMemberHandlers(t *testing.T) {
+	existing := []openfga.Tuple{
+		{Key: openfga.TupleKey{User: "user:alice", Relation: "subscriber", Object: "groupsio_mailing_list:list-123"}},
+	}
+
+	tests := []struct {
+		name          string
+		messageData   []byte
+		operation     memberOperation
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name:        "put subscriber by default",
+			messageData: mustJSON(memberStub{Username: "bob", MailingListUID: "list-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:bob" && req.Writes[0].Relation == "subscriber" &&
+						req.Writes[0].Object == "groupsio_mailing_list:list-123"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "put moderator keeps the subscription",
+			messageData: mustJSON(memberStub{Username: "alice", Relation: "moderator", MailingListUID: "list-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:alice" && req.Writes[0].Relation == "moderator"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "remove missing moderator is a no-op",
+			messageData: mustJSON(memberStub{Username: "alice", Relation: "moderator", MailingListUID: "list-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+			},
+		},
+		{
+			name:        "remove subscriber",
+			messageData: mustJSON(memberStub{Username: "alice", MailingListUID: "list-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 &&
+						req.Deletes[0].User == "user:alice" && req.Deletes[0].Relation == "subscriber"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name:        "unsupported relation",
+			messageData: mustJSON(memberStub{Username: "alice", Relation: "member", MailingListUID: "list-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing mailing list UID",
+			messageData: mustJSON(memberStub{Username: "alice", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			var err error
+			if tt.operation == memberRemove {
+				msg.subject = "lfx.remove_member.groupsio_mailing_list"
+				err = handlerService.mailingListMemberRemoveHandler(context.Background(), msg)
+			} else {
+				msg.subject = "lfx.put_member.groupsio_mailing_list"
+				err = handlerService.mailingListMemberPutHandler(context.Background(), msg)
+			}
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
@@ -5,9 +5,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
 	"github.com/openfga/go-sdk/client" // Only for client types, not the full SDK
@@ -53,78 +56,91 @@ func (h *HandlerService) buildMeetingTuples(
 	for _, principal := range meeting.Organizers {
 		tuples = append(
 			tuples,
-			h.fgaService.TupleKey(constants.ObjectTypeUser+principal, constants.RelationOrganizer, object),
+			h.fgaService.TupleKey(principalUser(principal), constants.RelationOrganizer, object),
 		)
 	}
 
 	return tuples, nil
 }
 
-// meetingUpdateAccessHandler handles meeting access control updates.
-func (h *HandlerService) meetingUpdateAccessHandler(message INatsMsg) error {
-	ctx := context.Background()
+// meetingUpdateAccessHandler handles meeting access control updates, in the
+// standard access format or the meeting format.
+func (h *HandlerService) meetingUpdateAccessHandler(ctx context.Context, message INatsMsg) error {
+	if hasObjectType(message.Data()) {
+		return h.updateAccessHandler(strings.TrimSuffix(constants.ObjectTypeMeeting, ":"))(ctx, message)
+	}
+	return h.meetingStubUpdateAccess(ctx, message)
+}
+
+// meetingStubUpdateAccess handles meeting access control updates in the
+// meeting format.
+func (h *HandlerService) meetingStubUpdateAccess(ctx context.Context, message INatsMsg) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
 
 	logger.With("message", string(message.Data())).InfoContext(ctx, "handling meeting access control update")
 
 	// Parse the event data.
 	meeting := new(meetingStub)
-	var err error
 	err = json.Unmarshal(message.Data(), meeting)
 	if err != nil {
 		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
-		return err
+		return newHandlerError(errCodeInvalidPayload, err)
 	}
 
 	// Grab the project ID.
 	if meeting.ProjectUID == "" {
 		logger.ErrorContext(ctx, "meeting project ID not found")
-		return errors.New("meeting project ID not found")
+		return newHandlerError(errCodeMissingUID, errors.New("meeting project ID not found"))
 	}
 
 	object := constants.ObjectTypeMeeting + meeting.UID
+	result.Object = object
 
 	// Build a list of tuples to sync.
 	//
-	// It is important that all tuples that should exist with respect to the meeting object
-	// should be added to this tuples list because when SyncObjectTuples is called, it will delete
-	// all tuples that are not in the tuples list parameter.
+	// It is important that all tuples of the relations owned by the meeting object should be
+	// added to this tuples list because when SyncObjectTuples is called, it will delete the
+	// tuples of those relations that are not in the tuples list parameter.
 	tuples, err := h.buildMeetingTuples(object, meeting)
 	if err != nil {
 		logger.With(errKey, err, "object", object).ErrorContext(ctx, "failed to build meeting tuples")
 		return err
 	}
 
-	tuplesWrites, tuplesDeletes, err := h.fgaService.SyncObjectTuples(ctx, object, tuples)
+	if err = authzModel.validateTuples(object, tuples); err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, msgUpdateModelMismatch)
+		return newHandlerError(errCodeSchemaViolation, err)
+	}
+
+	// Only the relations owned by the meeting are replaced, so that the
+	// registrant relations are kept.
+	result.Writes, result.Deletes, err = h.syncObjectTuples(
+		ctx, message, object, tuples, ownedRelations(strings.TrimSuffix(constants.ObjectTypeMeeting, ":"))...,
+	)
 	if err != nil {
 		logger.With(errKey, err, "tuples", tuples, "object", object).ErrorContext(ctx, "failed to sync tuples")
-		return err
+		return newHandlerError(errCodeUpstream, err)
 	}
 
 	logger.With(
 		"tuples", tuples,
 		"object", object,
-		"writes", tuplesWrites,
-		"deletes", tuplesDeletes,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+		"dry_run", isDryRun(message),
 	).InfoContext(ctx, "synced tuples")
 
-	if message.Reply() != "" {
-		// Send a reply if an inbox was provided.
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
-		}
-
-		logger.With("object", object).InfoContext(ctx, "sent meeting access control update response")
-	}
-
 	return nil
 }
 
 // meetingDeleteAllAccessHandler handles deleting all tuples for a meeting object.
 //
 // This should only happen when a meeting is deleted.
-func (h *HandlerService) meetingDeleteAllAccessHandler(message INatsMsg) error {
-	return h.processDeleteAllAccessMessage(message, constants.ObjectTypeMeeting, "meeting")
+func (h *HandlerService) meetingDeleteAllAccessHandler(ctx context.Context, message INatsMsg) error {
+	return h.processDeleteAllAccessMessage(ctx, message, constants.ObjectTypeMeeting, "meeting")
 }
 
 type registrantStub struct {
@@ -134,10 +150,21 @@ type registrantStub struct {
 	Username string `json:"username"`
 	// MeetingUID is the meeting ID for the meeting the registrant is registered for.
 	MeetingUID string `json:"meeting_uid"`
-	// Host determines whether the user should get host relation on the meeting
+	// Host determines whether the user should get host relation on the meeting.
+	// It is ignored on removal, which removes both relations.
 	Host bool `json:"host"`
 }
 
+// registrantsSyncStub is the full list of registrants of a meeting.
+type registrantsSyncStub struct {
+	// MeetingUID is the meeting ID for the meeting the registrants are registered for.
+	MeetingUID string `json:"meeting_uid"`
+	// Registrants are all the registrants of the meeting. The meeting and registrant IDs
+	// of the registrants are ignored. It is required, and only an explicit empty list
+	// removes every registrant.
+	Registrants []registrantStub `json:"registrants"`
+}
+
 // registrantOperation defines the type of operation to perform on a registrant
 type registrantOperation int
 
@@ -146,187 +173,435 @@ const (
 	registrantRemove
 )
 
+// Outcomes of the registrants of a bulk registrant request.
+const (
+	registrantChanged   = "changed"
+	registrantUnchanged = "unchanged"
+	registrantFailed    = "failed"
+)
+
+// registrantResult is the outcome for one registrant of a bulk registrant
+// request.
+type registrantResult struct {
+	Username   string                                  `json:"username"`
+	MeetingUID string                                  `json:"meeting_uid"`
+	Status     string                                  `json:"status"`
+	Writes     []client.ClientTupleKey                 `json:"writes,omitempty"`
+	Deletes    []client.ClientTupleKeyWithoutCondition `json:"deletes,omitempty"`
+	Error      *replyError                             `json:"error,omitempty"`
+}
+
+// registrantRelations are the registrant relations (participant or host) of
+// the users of a meeting.
+type registrantRelations map[string]map[string]bool
+
+// add records a tuple of the meeting, if it is a registrant relation.
+func (r registrantRelations) add(user, relation string) {
+	if relation != constants.RelationParticipant && relation != constants.RelationHost {
+		return
+	}
+	if r[user] == nil {
+		r[user] = make(map[string]bool)
+	}
+	r[user][relation] = true
+}
+
+// validateRegistrant checks the required fields of a registrant.
+func validateRegistrant(registrant *registrantStub) error {
+	if registrant.Username == "" {
+		return newHandlerError(errCodeMissingUID, errors.New("registrant username not found"))
+	}
+	if registrant.MeetingUID == "" {
+		return newHandlerError(errCodeMissingUID, errors.New("meeting UID not found"))
+	}
+	return nil
+}
+
 // processRegistrantMessage handles the complete message processing flow for registrant operations
-func (h *HandlerService) processRegistrantMessage(message INatsMsg, operation registrantOperation) error {
-	ctx := context.Background()
+func (h *HandlerService) processRegistrantMessage(
+	ctx context.Context,
+	message INatsMsg,
+	operation registrantOperation,
+) (err error) {
+	// A list of registrants is handled in bulk.
+	if data := bytes.TrimSpace(message.Data()); len(data) > 0 && data[0] == '[' {
+		return h.processRegistrantsMessage(ctx, message, operation)
+	}
+
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
 
 	// Log the operation type
 	operationType := "put"
-	responseMsg := "sent registrant put response"
 	if operation == registrantRemove {
 		operationType = "remove"
-		responseMsg = "sent registrant remove response"
 	}
 
 	logger.With("message", string(message.Data())).InfoContext(ctx, "handling meeting registrant "+operationType)
 
 	// Parse the event data.
 	registrant := new(registrantStub)
-	err := json.Unmarshal(message.Data(), registrant)
+	err = json.Unmarshal(message.Data(), registrant)
 	if err != nil {
 		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
-		return err
+		return newHandlerError(errCodeInvalidPayload, err)
 	}
 
 	// Validate required fields.
-	if registrant.Username == "" {
-		logger.ErrorContext(ctx, "registrant username not found")
-		return errors.New("registrant username not found")
-	}
-	if registrant.MeetingUID == "" {
-		logger.ErrorContext(ctx, "meeting UID not found")
-		return errors.New("meeting UID not found")
-	}
-
-	// Perform the FGA operation
-	err = h.handleRegistrantOperation(ctx, registrant, operation)
-	if err != nil {
+	if err = validateRegistrant(registrant); err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "invalid registrant")
 		return err
 	}
 
-	// Send reply if requested
-	if message.Reply() != "" {
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
-		}
+	result.Object = constants.ObjectTypeMeeting + registrant.MeetingUID
 
-		logger.InfoContext(ctx, responseMsg,
-			"meeting", constants.ObjectTypeMeeting+registrant.MeetingUID,
-			"registrant", constants.ObjectTypeUser+registrant.Username,
-		)
+	// Perform the FGA operation
+	result.Writes, result.Deletes, err = h.handleRegistrantOperation(ctx, message, registrant, operation)
+	if err != nil {
+		return newHandlerError(errCodeUpstream, err)
 	}
 
 	return nil
 }
 
-// handleRegistrantOperation handles the FGA operation for putting/removing registrants
-func (h *HandlerService) handleRegistrantOperation(
+// processRegistrantsMessage handles a list of registrants. The tuples of each
+// meeting are read once, and the combined changes are written in as few
+// transactions as possible. The reply has the outcome of each registrant.
+func (h *HandlerService) processRegistrantsMessage(
 	ctx context.Context,
-	registrant *registrantStub,
+	message INatsMsg,
 	operation registrantOperation,
-) error {
-	meetingObject := constants.ObjectTypeMeeting + registrant.MeetingUID
-	userPrincipal := constants.ObjectTypeUser + registrant.Username
+) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
 
-	switch operation {
-	case registrantPut:
-		return h.putRegistrant(ctx, userPrincipal, meetingObject, registrant.Host)
-	case registrantRemove:
-		return h.removeRegistrant(ctx, userPrincipal, meetingObject, registrant.Host)
-	default:
-		return errors.New("unknown registrant operation")
+	// Log the operation type
+	operationType := "put"
+	if operation == registrantRemove {
+		operationType = "remove"
 	}
-}
 
-// putRegistrant implements idempotent put operation for registrant relations
-func (h *HandlerService) putRegistrant(ctx context.Context, userPrincipal, meetingObject string, isHost bool) error {
-	// Determine the desired relation
-	desiredRelation := constants.RelationParticipant
-	if isHost {
-		desiredRelation = constants.RelationHost
+	logger.With("size", len(message.Data())).InfoContext(ctx, "handling bulk meeting registrant "+operationType)
+
+	// Parse the event data.
+	var registrants []registrantStub
+	err = json.Unmarshal(message.Data(), &registrants)
+	if err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+	if len(registrants) == 0 {
+		logger.ErrorContext(ctx, "empty registrant list")
+		return newHandlerError(errCodeInvalidPayload, errors.New("empty registrant list"))
+	}
+
+	// Group the valid registrants by meeting, keeping the order of the list.
+	result.Registrants = make([]registrantResult, len(registrants))
+	var meetingUIDs []string
+	byMeeting := make(map[string][]int)
+	for i := range registrants {
+		registrant := &registrants[i]
+		result.Registrants[i] = registrantResult{Username: registrant.Username, MeetingUID: registrant.MeetingUID}
+		if errInvalid := validateRegistrant(registrant); errInvalid != nil {
+			result.Registrants[i].Status = registrantFailed
+			result.Registrants[i].Error = &replyError{Code: errorCode(errInvalid), Message: errInvalid.Error()}
+			continue
+		}
+		if _, ok := byMeeting[registrant.MeetingUID]; !ok {
+			meetingUIDs = append(meetingUIDs, registrant.MeetingUID)
+		}
+		byMeeting[registrant.MeetingUID] = append(byMeeting[registrant.MeetingUID], i)
+	}
+	if len(meetingUIDs) == 1 {
+		result.Object = constants.ObjectTypeMeeting + meetingUIDs[0]
 	}
 
-	// Read existing relations for this user on this meeting
+	for _, meetingUID := range meetingUIDs {
+		meetingObject := constants.ObjectTypeMeeting + meetingUID
+		indexes := byMeeting[meetingUID]
+
+		var writes []client.ClientTupleKey
+		var deletes []client.ClientTupleKeyWithoutCondition
+		// The tuples of each registrant are at these offsets of the writes and
+		// deletes.
+		writeStarts, deleteStarts := make(map[int]int), make(map[int]int)
+		errMeeting := h.readRegistrantRelations(ctx, meetingObject, func(relations registrantRelations) {
+			for _, i := range indexes {
+				registrant := &registrants[i]
+				userPrincipal := constants.ObjectTypeUser + registrant.Username
+				registrantWrites, registrantDeletes := h.planRegistrant(
+					relations, userPrincipal, meetingObject, operation, registrant.Host,
+				)
+
+				result.Registrants[i].Status = registrantUnchanged
+				if len(registrantWrites) > 0 || len(registrantDeletes) > 0 {
+					result.Registrants[i].Status = registrantChanged
+				}
+				result.Registrants[i].Writes = registrantWrites
+				result.Registrants[i].Deletes = registrantDeletes
+				writeStarts[i], deleteStarts[i] = len(writes), len(deletes)
+				writes = append(writes, registrantWrites...)
+				deletes = append(deletes, registrantDeletes...)
+			}
+		})
+		var appliedWrites []client.ClientTupleKey
+		var appliedDeletes []client.ClientTupleKeyWithoutCondition
+		if errMeeting == nil {
+			appliedWrites, appliedDeletes, errMeeting = h.writeAndDeleteTuples(ctx, message, writes, deletes)
+		}
+		// When a later transaction fails, the earlier ones stay applied.
+		result.Writes = append(result.Writes, appliedWrites...)
+		result.Deletes = append(result.Deletes, appliedDeletes...)
+		if errMeeting != nil {
+			logger.ErrorContext(ctx, "failed to "+operationType+" meeting registrants",
+				errKey, errMeeting,
+				"meeting", meetingObject,
+				"registrants", len(indexes),
+			)
+			err = newHandlerError(errCodeUpstream, errMeeting)
+			for _, i := range indexes {
+				registrant := &result.Registrants[i]
+				// The registrants of a meeting whose relations could not be
+				// read were not planned.
+				if registrant.Status == "" {
+					registrant.Status = registrantFailed
+					registrant.Error = &replyError{Code: errCodeUpstream, Message: errMeeting.Error()}
+					continue
+				}
+				if registrant.Status != registrantChanged {
+					continue
+				}
+				// The writes and the deletes are applied in order, so the
+				// registrants whose tuples all landed are the first ones.
+				writeEnd := min(writeStarts[i]+len(registrant.Writes), len(appliedWrites))
+				deleteEnd := min(deleteStarts[i]+len(registrant.Deletes), len(appliedDeletes))
+				if writeEnd-writeStarts[i] == len(registrant.Writes) &&
+					deleteEnd-deleteStarts[i] == len(registrant.Deletes) {
+					continue
+				}
+				registrant.Status = registrantFailed
+				registrant.Error = &replyError{Code: errCodeUpstream, Message: errMeeting.Error()}
+				registrant.Writes = appliedWrites[min(writeStarts[i], writeEnd):writeEnd]
+				registrant.Deletes = appliedDeletes[min(deleteStarts[i], deleteEnd):deleteEnd]
+			}
+			continue
+		}
+
+		logger.With(
+			"meeting", meetingObject,
+			"registrants", len(indexes),
+			"writes", len(writes),
+			"deletes", len(deletes),
+		).InfoContext(ctx, "handled bulk meeting registrant "+operationType)
+	}
+
+	return err
+}
+
+// readRegistrantRelations reads the registrant relations of a meeting and
+// passes them to fn.
+func (h *HandlerService) readRegistrantRelations(
+	ctx context.Context,
+	meetingObject string,
+	fn func(registrantRelations),
+) error {
 	existingTuples, err := h.fgaService.ReadObjectTuples(ctx, meetingObject)
 	if err != nil {
 		logger.ErrorContext(ctx, "failed to read existing meeting tuples",
 			errKey, err,
-			"user", userPrincipal,
 			"meeting", meetingObject,
 		)
 		return err
 	}
 
-	// Find existing registrant relations for this user
-	var tuplesToDelete []client.ClientTupleKeyWithoutCondition
-	var hasDesiredRelation bool
-
+	relations := make(registrantRelations)
 	for _, tuple := range existingTuples {
-		if tuple.Key.User == userPrincipal &&
-			(tuple.Key.Relation == constants.RelationParticipant || tuple.Key.Relation == constants.RelationHost) {
-			if tuple.Key.Relation == desiredRelation {
-				hasDesiredRelation = true
-			} else {
-				// This is an existing relation that needs to be removed
-				tuplesToDelete = append(tuplesToDelete, client.ClientTupleKeyWithoutCondition{
-					User:     tuple.Key.User,
-					Relation: tuple.Key.Relation,
-					Object:   tuple.Key.Object,
-				})
-			}
-		}
+		relations.add(tuple.Key.User, tuple.Key.Relation)
+	}
+	fn(relations)
+
+	return nil
+}
+
+// planRegistrant computes the tuples to write and delete for a registrant
+// operation, and applies them to the registrant relations so that later
+// registrants of the same request see them.
+//
+// A put gives the user the participant or host relation, removing the other
+// one. A remove deletes both relations, whichever exist.
+func (h *HandlerService) planRegistrant(
+	relations registrantRelations,
+	userPrincipal, meetingObject string,
+	operation registrantOperation,
+	isHost bool,
+) ([]client.ClientTupleKey, []client.ClientTupleKeyWithoutCondition) {
+	// Determine the desired relation
+	desiredRelation := constants.RelationParticipant
+	if isHost {
+		desiredRelation = constants.RelationHost
+	}
+	if operation == registrantRemove {
+		desiredRelation = ""
 	}
 
-	// Prepare write operations
 	var tuplesToWrite []client.ClientTupleKey
-	if !hasDesiredRelation {
-		tuplesToWrite = append(tuplesToWrite, h.fgaService.TupleKey(userPrincipal, desiredRelation, meetingObject))
-	}
-
-	// Apply changes if needed
-	if len(tuplesToWrite) > 0 || len(tuplesToDelete) > 0 {
-		err = h.fgaService.WriteAndDeleteTuples(ctx, tuplesToWrite, tuplesToDelete)
-		if err != nil {
-			logger.ErrorContext(ctx, "failed to put registrant tuple",
-				errKey, err,
-				"user", userPrincipal,
-				"relation", desiredRelation,
-				"meeting", meetingObject,
+	var tuplesToDelete []client.ClientTupleKeyWithoutCondition
+	for _, relation := range []string{constants.RelationParticipant, constants.RelationHost} {
+		has := relations[userPrincipal][relation]
+		switch {
+		case relation == desiredRelation && !has:
+			tuplesToWrite = append(tuplesToWrite, h.fgaService.TupleKey(userPrincipal, relation, meetingObject))
+			relations.add(userPrincipal, relation)
+		case relation != desiredRelation && has:
+			tuplesToDelete = append(
+				tuplesToDelete,
+				h.fgaService.TupleKeyWithoutCondition(userPrincipal, relation, meetingObject),
 			)
-			return err
+			delete(relations[userPrincipal], relation)
 		}
-
-		logger.With(
-			"user", userPrincipal,
-			"relation", desiredRelation,
-			"meeting", meetingObject,
-		).InfoContext(ctx, "put registrant to meeting")
-	} else {
-		logger.With(
-			"user", userPrincipal,
-			"relation", desiredRelation,
-			"meeting", meetingObject,
-		).InfoContext(ctx, "registrant already has correct relation - no changes needed")
 	}
 
-	return nil
+	return tuplesToWrite, tuplesToDelete
 }
 
-// removeRegistrant removes all registrant relations for a user from a meeting
-func (h *HandlerService) removeRegistrant(ctx context.Context, userPrincipal, meetingObject string, isHost bool) error {
-	// Determine the relation to remove
-	relation := constants.RelationParticipant
-	if isHost {
-		relation = constants.RelationHost
+// handleRegistrantOperation handles the FGA operation for putting/removing
+// registrants, and returns the tuples that were written and deleted, or would
+// be for a dry run. Putting a registrant that already has the desired
+// relation, or removing a user who is not registered, is a no-op.
+func (h *HandlerService) handleRegistrantOperation(
+	ctx context.Context,
+	message INatsMsg,
+	registrant *registrantStub,
+	operation registrantOperation,
+) ([]client.ClientTupleKey, []client.ClientTupleKeyWithoutCondition, error) {
+	meetingObject := constants.ObjectTypeMeeting + registrant.MeetingUID
+	userPrincipal := constants.ObjectTypeUser + registrant.Username
+
+	var tuplesToWrite []client.ClientTupleKey
+	var tuplesToDelete []client.ClientTupleKeyWithoutCondition
+	err := h.readRegistrantRelations(ctx, meetingObject, func(relations registrantRelations) {
+		tuplesToWrite, tuplesToDelete = h.planRegistrant(
+			relations, userPrincipal, meetingObject, operation, registrant.Host,
+		)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tuplesToWrite) == 0 && len(tuplesToDelete) == 0 {
+		logger.With(
+			"user", userPrincipal,
+			"meeting", meetingObject,
+			"host", registrant.Host,
+		).InfoContext(ctx, "registrant already up to date - no changes needed")
+		return nil, nil, nil
 	}
 
-	err := h.fgaService.DeleteTuple(ctx, userPrincipal, relation, meetingObject)
+	_, _, err = h.writeAndDeleteTuples(ctx, message, tuplesToWrite, tuplesToDelete)
 	if err != nil {
-		logger.ErrorContext(ctx, "failed to remove registrant tuple",
+		logger.ErrorContext(ctx, "failed to update registrant tuples",
 			errKey, err,
 			"user", userPrincipal,
-			"relation", relation,
 			"meeting", meetingObject,
 		)
-		return err
+		return nil, nil, err
 	}
 
 	logger.With(
 		"user", userPrincipal,
-		"relation", relation,
 		"meeting", meetingObject,
-	).InfoContext(ctx, "removed registrant from meeting")
+		"writes", tuplesToWrite,
+		"deletes", tuplesToDelete,
+	).InfoContext(ctx, "updated registrant on meeting")
 
-	return nil
+	return tuplesToWrite, tuplesToDelete, nil
 }
 
 // meetingRegistrantPutHandler handles putting a registrant to a meeting (idempotent create/update).
-func (h *HandlerService) meetingRegistrantPutHandler(message INatsMsg) error {
-	return h.processRegistrantMessage(message, registrantPut)
+func (h *HandlerService) meetingRegistrantPutHandler(ctx context.Context, message INatsMsg) error {
+	return h.processRegistrantMessage(ctx, message, registrantPut)
 }
 
 // meetingRegistrantRemoveHandler handles removing a registrant from a meeting.
-func (h *HandlerService) meetingRegistrantRemoveHandler(message INatsMsg) error {
-	return h.processRegistrantMessage(message, registrantRemove)
+func (h *HandlerService) meetingRegistrantRemoveHandler(ctx context.Context, message INatsMsg) error {
+	return h.processRegistrantMessage(ctx, message, registrantRemove)
+}
+
+// meetingRegistrantsSyncHandler replaces the registrants of a meeting with the
+// given full list. Only the participant and host relations of the meeting are
+// synced, so registrants that are not in the list lose their access.
+func (h *HandlerService) meetingRegistrantsSyncHandler(ctx context.Context, message INatsMsg) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
+
+	logger.With("size", len(message.Data())).InfoContext(ctx, "handling meeting registrants sync")
+
+	// Parse the event data.
+	sync := new(registrantsSyncStub)
+	err = json.Unmarshal(message.Data(), sync)
+	if err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+
+	if sync.MeetingUID == "" {
+		logger.ErrorContext(ctx, "meeting UID not found")
+		return newHandlerError(errCodeMissingUID, errors.New("meeting UID not found"))
+	}
+
+	object := constants.ObjectTypeMeeting + sync.MeetingUID
+	result.Object = object
+
+	// A missing or null list is not taken as an empty one, which would remove
+	// every registrant of the meeting.
+	if sync.Registrants == nil {
+		logger.ErrorContext(ctx, "registrant list not found", "meeting", object)
+		return newHandlerError(errCodeInvalidPayload, errors.New("registrant list not found"))
+	}
+
+	// A registrant listed more than once is a host if any entry says so.
+	var usernames []string
+	hosts := make(map[string]bool, len(sync.Registrants))
+	for _, registrant := range sync.Registrants {
+		if registrant.Username == "" {
+			logger.ErrorContext(ctx, "registrant username not found", "meeting", object)
+			return newHandlerError(errCodeMissingUID, errors.New("registrant username not found"))
+		}
+		if _, ok := hosts[registrant.Username]; !ok {
+			usernames = append(usernames, registrant.Username)
+		}
+		hosts[registrant.Username] = hosts[registrant.Username] || registrant.Host
+	}
+
+	tuples := h.fgaService.NewTupleKeySlice(len(usernames))
+	for _, username := range usernames {
+		relation := constants.RelationParticipant
+		if hosts[username] {
+			relation = constants.RelationHost
+		}
+		tuples = append(tuples, h.fgaService.TupleKey(constants.ObjectTypeUser+username, relation, object))
+	}
+
+	result.Writes, result.Deletes, err = h.syncObjectTuples(
+		ctx, message, object, tuples, constants.RelationParticipant, constants.RelationHost,
+	)
+	if err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, "failed to sync meeting registrants")
+		return newHandlerError(errCodeUpstream, err)
+	}
+
+	logger.With(
+		"object", object,
+		"registrants", len(usernames),
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+	).InfoContext(ctx, "synced meeting registrants")
+
+	return nil
 }
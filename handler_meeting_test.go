@@ -4,6 +4,10 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
 	"testing"
 
 	openfga "github.com/openfga/go-sdk"
@@ -34,7 +38,7 @@ func TestMeetingUpdateAccessHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation for SyncObjectTuples
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -96,25 +100,97 @@ func TestMeetingUpdateAccessHandler(t *testing.T) {
 			expectedError:  false,
 			expectedCalled: false,
 		},
+		{
+			name: "standard access payload keeps registrants",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "meeting-123",
+				ObjectType: "meeting",
+				Relations:  map[string][]string{"organizer": {"organizer1"}},
+				References: map[string]referenceList{
+					"project":   {{ID: "project-456"}},
+					"committee": {{ID: "committee1"}, {ID: "committee2"}},
+				},
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "meeting:meeting-123"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+					{Key: openfga.TupleKey{User: "user:organizer2", Relation: "organizer", Object: "meeting:meeting-123"}},
+					{Key: openfga.TupleKey{User: "user:participant1", Relation: "participant", Object: "meeting:meeting-123"}},
+					{Key: openfga.TupleKey{User: "user:host1", Relation: "host", Object: "meeting:meeting-123"}},
+				}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					// 1 project + 2 committees + 1 organizer written, only the stale organizer deleted.
+					return len(req.Writes) == 4 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:organizer2"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				service.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name: "meeting payload keeps registrants",
+			messageData: mustJSON(meetingStub{
+				UID:        "meeting-123",
+				ProjectUID: "project-456",
+				Organizers: []string{"organizer1"},
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "meeting:meeting-123"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+					{Key: openfga.TupleKey{User: "user:organizer2", Relation: "organizer", Object: "meeting:meeting-123"}},
+					{Key: openfga.TupleKey{User: "user:participant1", Relation: "participant", Object: "meeting:meeting-123"}},
+					{Key: openfga.TupleKey{User: "user:host1", Relation: "host", Object: "meeting:meeting-123"}},
+				}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					// 1 project + 1 organizer written, only the stale organizer deleted.
+					return len(req.Writes) == 2 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:organizer2"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				service.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name: "standard access payload with a registrant relation",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "meeting-123",
+				ObjectType: "meeting",
+				Relations:  map[string][]string{"participant": {"participant1"}},
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
+		},
 		{
 			name:         "invalid JSON",
 			messageData:  []byte("invalid-json"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at JSON parsing
+				// Should fail at JSON parsing and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "missing project UID",
 			messageData:  mustJSON(meetingStub{UID: "meeting-123"}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at project UID validation
+				// Should fail at project UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name: "GetTuplesByRelation fails - should continue",
@@ -161,7 +237,7 @@ func TestMeetingUpdateAccessHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.meetingUpdateAccessHandler(msg)
+				err := handlerService.meetingUpdateAccessHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -195,7 +271,7 @@ func TestMeetingDeleteAllAccessHandler(t *testing.T) {
 			messageData:  []byte("meeting-123"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation to return some existing tuples
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -224,30 +300,33 @@ func TestMeetingDeleteAllAccessHandler(t *testing.T) {
 			messageData:  []byte(""),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at UID validation
+				// Should fail at UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "serialized JSON payload (should fail)",
 			messageData:  []byte(`{"uid": "meeting-123"}`),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at payload validation
+				// Should fail at payload validation and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "array payload (should fail)",
 			messageData:  []byte(`["meeting-123"]`),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at payload validation
+				// Should fail at payload validation and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 	}
 
@@ -261,7 +340,7 @@ func TestMeetingDeleteAllAccessHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.meetingDeleteAllAccessHandler(msg)
+				err := handlerService.meetingDeleteAllAccessHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -298,7 +377,7 @@ func TestMeetingRegistrantPutHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation to check existing relations (return empty - new registrant)
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -364,7 +443,7 @@ func TestMeetingRegistrantPutHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation to return existing participant relation
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -424,30 +503,33 @@ func TestMeetingRegistrantPutHandler(t *testing.T) {
 			messageData:  []byte("invalid-json"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at JSON parsing
+				// Should fail at JSON parsing and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "missing registrant LFID",
 			messageData:  mustJSON(registrantStub{MeetingUID: "meeting-456"}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at LFID validation
+				// Should fail at LFID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "missing meeting UID",
 			messageData:  mustJSON(registrantStub{Username: "user-123"}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at meeting UID validation
+				// Should fail at meeting UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name: "read operation fails",
@@ -478,7 +560,7 @@ func TestMeetingRegistrantPutHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.meetingRegistrantPutHandler(msg)
+				err := handlerService.meetingRegistrantPutHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -515,7 +597,15 @@ func TestMeetingRegistrantRemoveHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
+
+				// Mock the Read operation to return the existing participant relation
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+					Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:user-123", Relation: "participant", Object: "meeting:meeting-456"}},
+						{Key: openfga.TupleKey{User: "user:other-user", Relation: "participant", Object: "meeting:meeting-456"}},
+					},
+				}, nil).Once()
 
 				// Mock the Write operation for deleting participant relation
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
@@ -542,6 +632,13 @@ func TestMeetingRegistrantRemoveHandler(t *testing.T) {
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
 				// No reply expected
 
+				// Mock the Read operation to return the existing host relation
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+					Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:host-123", Relation: "host", Object: "meeting:meeting-456"}},
+					},
+				}, nil).Once()
+
 				// Mock the Write operation for deleting host relation
 				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
 					return len(req.Writes) == 0 && len(req.Deletes) == 1 &&
@@ -561,30 +658,119 @@ func TestMeetingRegistrantRemoveHandler(t *testing.T) {
 			messageData:  []byte("invalid-json"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at JSON parsing
+				// Should fail at JSON parsing and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
+		},
+		{
+			name: "remove participant promoted to host",
+			messageData: mustJSON(registrantStub{
+				Username:   "user-123",
+				MeetingUID: "meeting-456",
+				Host:       false,
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+
+				// The stored relation differs from the payload's host flag.
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+					Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:user-123", Relation: "host", Object: "meeting:meeting-456"}},
+					},
+				}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 &&
+						req.Deletes[0].User == "user:user-123" &&
+						req.Deletes[0].Relation == "host"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				service.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Once()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name: "remove both participant and host",
+			messageData: mustJSON(registrantStub{
+				Username:   "user-123",
+				MeetingUID: "meeting-456",
+				Host:       true,
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+					Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:user-123", Relation: "participant", Object: "meeting:meeting-456"}},
+						{Key: openfga.TupleKey{User: "user:user-123", Relation: "host", Object: "meeting:meeting-456"}},
+						{Key: openfga.TupleKey{User: "user:user-123", Relation: "organizer", Object: "meeting:meeting-456"}},
+					},
+				}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 2
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				service.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Once()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name: "remove unregistered user is a no-op",
+			messageData: mustJSON(registrantStub{
+				Username:   "user-123",
+				MeetingUID: "meeting-456",
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+					Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:other-user", Relation: "participant", Object: "meeting:meeting-456"}},
+					},
+				}, nil).Once()
+				// No Write operation expected.
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name: "read operation fails",
+			messageData: mustJSON(registrantStub{
+				Username:   "user-123",
+				MeetingUID: "meeting-456",
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), assert.AnError).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
 		},
 		{
 			name:         "missing registrant UID",
 			messageData:  mustJSON(registrantStub{MeetingUID: "meeting-456"}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at UID validation
+				// Should fail at UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "missing meeting UID",
 			messageData:  mustJSON(registrantStub{Username: "user-123"}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at meeting UID validation
+				// Should fail at meeting UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 	}
 
@@ -598,13 +784,14 @@ func TestMeetingRegistrantRemoveHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.meetingRegistrantRemoveHandler(msg)
+				err := handlerService.meetingRegistrantRemoveHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
 					assert.NoError(t, err)
 				}
 			})
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
 
 			// Verify mock expectations
 			if tt.expectedCalled {
@@ -615,3 +802,387 @@ func TestMeetingRegistrantRemoveHandler(t *testing.T) {
 		})
 	}
 }
+
+// bulkReply matches a bulk registrant reply with the given error code (empty
+// for success) and registrant statuses.
+func bulkReply(code string, statuses ...string) any {
+	return mock.MatchedBy(func(data []byte) bool {
+		var reply syncResult
+		if json.Unmarshal(data, &reply) != nil || len(reply.Registrants) != len(statuses) {
+			return false
+		}
+		if (code == "") != (reply.Error == nil) || (reply.Error != nil && reply.Error.Code != code) {
+			return false
+		}
+		for i, status := range statuses {
+			if reply.Registrants[i].Status != status || (status == registrantFailed) != (reply.Registrants[i].Error != nil) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// TestMeetingRegistrantBulkHandlers tests registrant put and remove messages
+// with a list of registrants.
+func TestMeetingRegistrantBulkHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		operation     registrantOperation
+		messageData   []byte
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name:      "put registrants of one meeting with a single read and write",
+			operation: registrantPut,
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+				{Username: "bob", MeetingUID: "meeting-1", Host: true},
+				{Username: "carol", MeetingUID: "meeting-1"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:bob", Relation: "participant", Object: "meeting:meeting-1"}},
+						{Key: openfga.TupleKey{User: "user:carol", Relation: "participant", Object: "meeting:meeting-1"}},
+					}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 2 && len(req.Deletes) == 1 &&
+						req.Writes[0].User == "user:alice" && req.Writes[1].User == "user:bob" &&
+						req.Writes[1].Relation == "host" && req.Deletes[0].User == "user:bob"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", bulkReply("", registrantChanged, registrantChanged, registrantUnchanged)).Return(nil).Once()
+			},
+		},
+		{
+			name:      "duplicate registrants see earlier changes",
+			operation: registrantPut,
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+				{Username: "alice", MeetingUID: "meeting-1"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", bulkReply("", registrantChanged, registrantUnchanged)).Return(nil).Once()
+			},
+		},
+		{
+			name:      "remove registrants of two meetings",
+			operation: registrantRemove,
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+				{Username: "bob", MeetingUID: "meeting-2"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return *req.Object == "meeting:meeting-1"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+					{Key: openfga.TupleKey{User: "user:alice", Relation: "host", Object: "meeting:meeting-1"}},
+				}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return *req.Object == "meeting:meeting-2"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].Relation == "host"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", bulkReply("", registrantChanged, registrantUnchanged)).Return(nil).Once()
+			},
+		},
+		{
+			name:      "invalid registrants fail without failing the others",
+			operation: registrantPut,
+			messageData: mustJSON([]registrantStub{
+				{MeetingUID: "meeting-1"},
+				{Username: "alice", MeetingUID: "meeting-1"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).
+					Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", bulkReply("", registrantFailed, registrantChanged)).Return(nil).Once()
+			},
+		},
+		{
+			name:      "write error fails the changed registrants",
+			operation: registrantPut,
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).
+					Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+				msg.On("Respond", bulkReply(errCodeUpstream, registrantFailed)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:      "read error fails the registrants of the meeting",
+			operation: registrantPut,
+			messageData: mustJSON([]registrantStub{
+				{Username: "alice", MeetingUID: "meeting-1"},
+				{Username: "bob", MeetingUID: "meeting-2"},
+				{Username: "carol", MeetingUID: "meeting-1"},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return *req.Object == "meeting:meeting-1"
+				}), mock.Anything).Return((*ClientReadResponse)(nil), errors.New("read failed")).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return *req.Object == "meeting:meeting-2"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.Anything).
+					Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", bulkReply(errCodeUpstream, registrantFailed, registrantChanged, registrantFailed)).
+					Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "empty list",
+			operation:   registrantPut,
+			messageData: []byte(" []"),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			handler := handlerService.meetingRegistrantPutHandler
+			if tt.operation == registrantRemove {
+				handler = handlerService.meetingRegistrantRemoveHandler
+			}
+			err := handler(context.Background(), msg)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
+
+// TestMeetingRegistrantBulkPartialWrite tests that when a later transaction of
+// a bulk registrant request fails, the registrants whose tuples were written by
+// the earlier transactions are reported as changed.
+func TestMeetingRegistrantBulkPartialWrite(t *testing.T) {
+	// 99 new participants, a participant becoming a host, and a new participant:
+	// the first transaction has the 99 writes and bob's host write, the second
+	// one carol's write and bob's participant delete.
+	registrants := make([]registrantStub, 0, maxTuplesPerWrite+1)
+	statuses := make([]string, 0, maxTuplesPerWrite+1)
+	for i := range maxTuplesPerWrite - 1 {
+		registrants = append(registrants, registrantStub{Username: "user" + strconv.Itoa(i), MeetingUID: "meeting-1"})
+		statuses = append(statuses, registrantChanged)
+	}
+	registrants = append(registrants,
+		registrantStub{Username: "bob", MeetingUID: "meeting-1", Host: true},
+		registrantStub{Username: "carol", MeetingUID: "meeting-1"},
+	)
+	statuses = append(statuses, registrantFailed, registrantFailed)
+
+	msg := CreateMockNatsMsg(mustJSON(registrants))
+	msg.reply = "reply.subject"
+
+	handlerService := setupService()
+	fgaClient := handlerService.fgaService.client.(*MockFgaClient)
+	fgaClient.On("Read", mock.Anything, mock.Anything, mock.Anything).
+		Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+			{Key: openfga.TupleKey{User: "user:bob", Relation: "participant", Object: "meeting:meeting-1"}},
+		}}, nil).Once()
+	fgaClient.On("Write", mock.Anything, mock.Anything).Return(&ClientWriteResponse{}, nil).Once()
+	fgaClient.On("Write", mock.Anything, mock.Anything).
+		Return((*ClientWriteResponse)(nil), errors.New("write failed")).Once()
+	handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+	var reply syncResult
+	msg.On("Respond", bulkReply(errCodeUpstream, statuses...)).Run(func(args mock.Arguments) {
+		assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+	}).Return(nil).Once()
+
+	assert.Error(t, handlerService.meetingRegistrantPutHandler(context.Background(), msg))
+
+	msg.AssertExpectations(t)
+	fgaClient.AssertExpectations(t)
+	assert.Len(t, reply.Writes, maxTuplesPerWrite)
+	assert.Empty(t, reply.Deletes)
+	if assert.Len(t, reply.Registrants, maxTuplesPerWrite+1) {
+		// Bob's host relation was written, but the participant one is left.
+		bob, carol := reply.Registrants[maxTuplesPerWrite-1], reply.Registrants[maxTuplesPerWrite]
+		assert.Equal(t, []ClientTupleKey{{User: "user:bob", Relation: "host", Object: "meeting:meeting-1"}}, bob.Writes)
+		assert.Empty(t, bob.Deletes)
+		assert.NotNil(t, bob.Error)
+		assert.Empty(t, carol.Writes)
+	}
+}
+
+// TestMeetingRegistrantsSyncHandler tests the meetingRegistrantsSyncHandler function
+func TestMeetingRegistrantsSyncHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		messageData   []byte
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name: "sync adds, swaps and removes registrants only",
+			messageData: mustJSON(registrantsSyncStub{
+				MeetingUID: "meeting-1",
+				Registrants: []registrantStub{
+					{Username: "alice"},
+					{Username: "bob", Host: true},
+					{Username: "carol"},
+				},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "meeting:meeting-1"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+					{Key: openfga.TupleKey{User: "user:bob", Relation: "participant", Object: "meeting:meeting-1"}},
+					{Key: openfga.TupleKey{User: "user:carol", Relation: "participant", Object: "meeting:meeting-1"}},
+					{Key: openfga.TupleKey{User: "user:dave", Relation: "host", Object: "meeting:meeting-1"}},
+					{Key: openfga.TupleKey{User: "user:erin", Relation: "organizer", Object: "meeting:meeting-1"}},
+					{Key: openfga.TupleKey{User: "project:p1", Relation: "project", Object: "meeting:meeting-1"}},
+				}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					if len(req.Writes) != 2 || len(req.Deletes) != 2 {
+						return false
+					}
+					deleted := map[string]string{}
+					for _, tuple := range req.Deletes {
+						deleted[tuple.User] = tuple.Relation
+					}
+					return deleted["user:bob"] == "participant" && deleted["user:dave"] == "host"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
+			},
+		},
+		{
+			name: "duplicate registrant is a host if any entry says so",
+			messageData: mustJSON(registrantsSyncStub{
+				MeetingUID: "meeting-1",
+				Registrants: []registrantStub{
+					{Username: "alice", Host: true},
+					{Username: "alice"},
+				},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && req.Writes[0].Relation == "host" && len(req.Deletes) == 0
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
+			},
+		},
+		{
+			name:        "empty list removes every registrant",
+			messageData: []byte(`{"meeting_uid": "meeting-1", "registrants": []}`),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:alice", Relation: "participant", Object: "meeting:meeting-1"}},
+						{Key: openfga.TupleKey{User: "user:erin", Relation: "organizer", Object: "meeting:meeting-1"}},
+					}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:alice"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
+			},
+		},
+		{
+			name:        "missing registrant list",
+			messageData: []byte(`{"meeting_uid": "meeting-1"}`),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "null registrant list",
+			messageData: []byte(`{"meeting_uid": "meeting-1", "registrants": null}`),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing meeting UID",
+			messageData: mustJSON(registrantsSyncStub{Registrants: []registrantStub{{Username: "alice"}}}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name: "missing registrant username",
+			messageData: mustJSON(registrantsSyncStub{
+				MeetingUID:  "meeting-1",
+				Registrants: []registrantStub{{Host: true}},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "invalid JSON",
+			messageData: []byte("{invalid"),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "read error",
+			messageData: mustJSON(registrantsSyncStub{MeetingUID: "meeting-1", Registrants: []registrantStub{}}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), errors.New("read failed")).Once()
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			msg.subject = "lfx.sync_registrants.meeting"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+
+			err := handlerService.meetingRegistrantsSyncHandler(context.Background(), msg)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/openfga/go-sdk/client"
+)
+
+// memberStub is the payload of the member put and remove subjects.
+type memberStub struct {
+	// Username is the username (i.e. LFID) of the member. This is the identity
+	// of the user object in FGA. A userset such as "team:abc#member" can be
+	// used to nest a group.
+	Username string `json:"username"`
+	// Relation is the member relation, for object types with more than one.
+	// It defaults to the first member relation of the object type.
+	Relation string `json:"relation,omitempty"`
+	// Role is the role of the member, for object types that map roles to
+	// member relations. It takes precedence over the relation.
+	Role string `json:"role,omitempty"`
+	// TeamUID is the team ID for the team the user is a member of.
+	TeamUID string `json:"team_uid,omitempty"`
+	// CommitteeUID is the committee ID for the committee the user is a member
+	// of.
+	CommitteeUID string `json:"committee_uid,omitempty"`
+	// MailingListUID is the mailing list ID for the mailing list the user is a
+	// member of.
+	MailingListUID string `json:"mailing_list_uid,omitempty"`
+}
+
+// memberType describes an object type whose members are managed by put and
+// remove subjects.
+type memberType struct {
+	// name is the object type name used in logs and errors.
+	name string
+	// objectType is the object type prefix, e.g. "team:".
+	objectType string
+	// relations are the member relations of the object type. The first one is
+	// the default.
+	relations []string
+	// exclusive is set when a member has at most one of the relations, so that
+	// a put replaces the member's other relation and a remove deletes any of
+	// them, like meeting registrants.
+	exclusive bool
+	// roles maps the roles of the payload to member relations.
+	roles map[string]string
+	// uid returns the ID of the object from the payload.
+	uid func(*memberStub) string
+}
+
+// memberOperation defines the type of operation to perform on a member
+type memberOperation int
+
+const (
+	memberPut memberOperation = iota
+	memberRemove
+)
+
+// processMemberMessage handles the complete message processing flow for
+// member operations.
+func (h *HandlerService) processMemberMessage(
+	ctx context.Context,
+	message INatsMsg,
+	members memberType,
+	operation memberOperation,
+) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
+
+	// Log the operation type
+	operationType := "put"
+	if operation == memberRemove {
+		operationType = "remove"
+	}
+
+	logger.With("message", string(message.Data())).InfoContext(ctx, "handling "+members.name+" member "+operationType)
+
+	// Parse the event data.
+	member := new(memberStub)
+	err = json.Unmarshal(message.Data(), member)
+	if err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+
+	// Validate required fields.
+	if member.Username == "" {
+		logger.ErrorContext(ctx, "member username not found")
+		return newHandlerError(errCodeMissingUID, errors.New("member username not found"))
+	}
+	objectUID := members.uid(member)
+	if objectUID == "" {
+		logger.ErrorContext(ctx, members.name+" UID not found")
+		return newHandlerError(errCodeMissingUID, errors.New(members.name+" UID not found"))
+	}
+
+	relation := member.Relation
+	if member.Role != "" {
+		var ok bool
+		if relation, ok = members.roles[member.Role]; !ok {
+			logger.With("role", member.Role).ErrorContext(ctx, "unsupported "+members.name+" member role")
+			return newHandlerError(
+				errCodeInvalidPayload,
+				fmt.Errorf("role %q is not a %s member role", member.Role, members.name),
+			)
+		}
+	}
+	if relation == "" {
+		relation = members.relations[0]
+	}
+	if !slices.Contains(members.relations, relation) {
+		logger.With("relation", relation).ErrorContext(ctx, "unsupported "+members.name+" member relation")
+		return newHandlerError(
+			errCodeInvalidPayload,
+			fmt.Errorf("relation %q is not a %s member relation", relation, members.name),
+		)
+	}
+
+	object := members.objectType + objectUID
+	user := principalUser(member.Username)
+	result.Object = object
+
+	adds := []client.ClientTupleKey{h.fgaService.TupleKey(user, relation, object)}
+	if err = authzModel.validateTuples(object, adds); err != nil {
+		logger.With(errKey, err, "object", object).
+			ErrorContext(ctx, members.name+" member does not match the authorization model")
+		return newHandlerError(errCodeSchemaViolation, err)
+	}
+
+	// Exclusive relations are swapped in a single write: the desired relation
+	// is added and the member's other relations are removed. A remove deletes
+	// whichever relation the member has.
+	var removes []client.ClientTupleKey
+	if members.exclusive {
+		for _, other := range members.relations {
+			if other != relation || operation == memberRemove {
+				removes = append(removes, h.fgaService.TupleKey(user, other, object))
+			}
+		}
+	}
+	if operation == memberRemove {
+		if !members.exclusive {
+			removes = adds
+		}
+		adds = nil
+	}
+
+	// Adding an existing member, or removing a missing one, is a no-op.
+	result.Writes, result.Deletes, err = h.patchObjectTuples(ctx, message, object, adds, removes)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to "+operationType+" "+members.name+" member",
+			errKey, err,
+			"user", member.Username,
+			"relation", relation,
+			"object", object,
+		)
+		return newHandlerError(errCodeUpstream, err)
+	}
+
+	logger.With(
+		"user", member.Username,
+		"relation", relation,
+		"object", object,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+	).InfoContext(ctx, "handled "+members.name+" member "+operationType)
+
+	return nil
+}
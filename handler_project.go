@@ -8,6 +8,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
 )
@@ -23,28 +25,41 @@ type projectStub struct {
 	MeetingCoordinators []string `json:"meeting_coordinators"`
 }
 
-// projectUpdateAccessHandler handles project access control updates.
-func (h *HandlerService) projectUpdateAccessHandler(message INatsMsg) error {
-	ctx := context.Background()
+// projectUpdateAccessHandler handles project access control updates, in the
+// standard access format or the project format.
+func (h *HandlerService) projectUpdateAccessHandler(ctx context.Context, message INatsMsg) error {
+	if hasObjectType(message.Data()) {
+		return h.updateAccessHandler(strings.TrimSuffix(constants.ObjectTypeProject, ":"))(ctx, message)
+	}
+	return h.projectStubUpdateAccess(ctx, message)
+}
+
+// projectStubUpdateAccess handles project access control updates in the
+// project format.
+func (h *HandlerService) projectStubUpdateAccess(ctx context.Context, message INatsMsg) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
 
 	logger.With("message", string(message.Data())).InfoContext(ctx, "handling project access control update")
 
 	// Parse the event data.
 	project := new(projectStub)
-	var err error
 	err = json.Unmarshal(message.Data(), project)
 	if err != nil {
 		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
-		return err
+		return newHandlerError(errCodeInvalidPayload, err)
 	}
 
 	// Grab the project ID.
 	if project.UID == "" {
 		logger.ErrorContext(ctx, "project ID not found")
-		return errors.New("project ID not found")
+		return newHandlerError(errCodeMissingUID, errors.New("project ID not found"))
 	}
 
 	object := constants.ObjectTypeProject + project.UID
+	result.Object = object
 
 	// Build a list of tuples to sync.
 	tuples := h.fgaService.NewTupleKeySlice(4)
@@ -65,45 +80,41 @@ func (h *HandlerService) projectUpdateAccessHandler(message INatsMsg) error {
 	// Add each principal from the object as the corresponding relationship tuple
 	// (as defined in the OpenFGA schema).
 	for _, principal := range project.Writers {
-		tuples = append(tuples, h.fgaService.TupleKey(constants.ObjectTypeUser+principal, constants.RelationWriter, object))
+		tuples = append(tuples, h.fgaService.TupleKey(principalUser(principal), constants.RelationWriter, object))
 	}
 	for _, principal := range project.Auditors {
-		tuples = append(tuples, h.fgaService.TupleKey(constants.ObjectTypeUser+principal, constants.RelationAuditor, object))
+		tuples = append(tuples, h.fgaService.TupleKey(principalUser(principal), constants.RelationAuditor, object))
 	}
 	for _, principal := range project.MeetingCoordinators {
 		tuples = append(
 			tuples,
-			h.fgaService.TupleKey(constants.ObjectTypeUser+principal, constants.RelationMeetingCoordinator, object),
+			h.fgaService.TupleKey(principalUser(principal), constants.RelationMeetingCoordinator, object),
 		)
 	}
 
-	tuplesWrites, tuplesDeletes, err := h.fgaService.SyncObjectTuples(ctx, object, tuples)
+	if err = authzModel.validateTuples(object, tuples); err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, msgUpdateModelMismatch)
+		return newHandlerError(errCodeSchemaViolation, err)
+	}
+
+	result.Writes, result.Deletes, err = h.syncObjectTuples(ctx, message, object, tuples)
 	if err != nil {
 		logger.With(errKey, err, "tuples", tuples, "object", object).ErrorContext(ctx, "failed to sync tuples")
-		return err
+		return newHandlerError(errCodeUpstream, err)
 	}
 
 	logger.With(
 		"tuples", tuples,
 		"object", object,
-		"writes", tuplesWrites,
-		"deletes", tuplesDeletes,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+		"dry_run", isDryRun(message),
 	).InfoContext(ctx, "synced tuples")
 
-	if message.Reply() != "" {
-		// Send a reply if an inbox was provided.
-		if err = message.Respond([]byte("OK")); err != nil {
-			logger.With(errKey, err).WarnContext(ctx, "failed to send reply")
-			return err
-		}
-
-		logger.With("object", object).InfoContext(ctx, "sent project access control update response")
-	}
-
 	return nil
 }
 
 // projectDeleteAllAccessHandler handles project access control deletions.
-func (h *HandlerService) projectDeleteAllAccessHandler(message INatsMsg) error {
-	return h.processDeleteAllAccessMessage(message, constants.ObjectTypeProject, "project")
+func (h *HandlerService) projectDeleteAllAccessHandler(ctx context.Context, message INatsMsg) error {
+	return h.processDeleteAllAccessMessage(ctx, message, constants.ObjectTypeProject, "project")
 }
@@ -4,9 +4,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
+	nats "github.com/nats-io/nats.go"
 	openfga "github.com/openfga/go-sdk"
 	. "github.com/openfga/go-sdk/client"
 	"github.com/stretchr/testify/assert"
@@ -36,7 +38,7 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation to return existing tuples
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -102,7 +104,7 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -132,7 +134,7 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -159,30 +161,33 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			messageData:  []byte("invalid-json"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at JSON parsing
+				// Should fail at JSON parsing and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "empty project UID",
 			messageData:  mustJSON(projectStub{}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at UID validation
+				// Should fail at UID validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "empty message",
 			messageData:  []byte(""),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at JSON parsing
+				// Should fail at JSON parsing and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name: "project with empty arrays",
@@ -205,6 +210,48 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			expectedError:  false,
 			expectedCalled: false,
 		},
+		{
+			name: "standard access payload",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "standard-project",
+				ObjectType: "project",
+				Public:     true,
+				Relations:  map[string][]string{"writer": {"user1"}, "meeting_coordinator": {"coordinator1"}},
+				References: map[string]referenceList{"parent": {{ID: "parent-project-456"}}},
+			}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "project:standard-project"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					// 1 public viewer + 1 parent + 1 writer + 1 meeting coordinator = 4
+					if len(req.Writes) != 4 || len(req.Deletes) != 0 {
+						return false
+					}
+					for _, tuple := range req.Writes {
+						if tuple.Relation == "parent" && tuple.User != "project:parent-project-456" {
+							return false
+						}
+					}
+					return true
+				})).Return(&ClientWriteResponse{}, nil).Once()
+				service.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name:         "standard access payload for another object type",
+			messageData:  mustJSON(standardAccessStub{UID: "standard-project", ObjectType: "committee"}),
+			replySubject: "reply.subject",
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
+		},
 		{
 			name: "respond error handling",
 			messageData: mustJSON(projectStub{
@@ -213,7 +260,7 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 			}),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(assert.AnError).Once()
+				msg.On("Respond", successReply()).Return(assert.AnError).Once()
 
 				// Mock the Read and Write operations
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
@@ -238,7 +285,7 @@ func TestProjectUpdateAccessHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.projectUpdateAccessHandler(msg)
+				err := handlerService.projectUpdateAccessHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -273,7 +320,7 @@ func TestProjectDeleteAllAccessHandler(t *testing.T) {
 			messageData:  []byte("test-project-123"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(nil).Once()
+				msg.On("Respond", successReply()).Return(nil).Once()
 
 				// Mock the Read operation to return some existing tuples
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
@@ -303,40 +350,44 @@ func TestProjectDeleteAllAccessHandler(t *testing.T) {
 			messageData:  []byte(""),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at validation
+				// Should fail at validation and reply with an error
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "JSON object payload",
 			messageData:  []byte(`{"uid": "test"}`),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at validation
+				// Should fail at validation and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "JSON array payload",
 			messageData:  []byte(`["test"]`),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at validation
+				// Should fail at validation and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "quoted string payload",
 			messageData:  []byte(`"test-project"`),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				// No mocks needed - should fail at validation
+				// Should fail at validation and reply with an error
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
 			},
 			expectedError:  true,
-			expectedCalled: false,
+			expectedCalled: true,
 		},
 		{
 			name:         "project UID without reply",
@@ -388,7 +439,7 @@ func TestProjectDeleteAllAccessHandler(t *testing.T) {
 			messageData:  []byte("error-project"),
 			replySubject: "reply.subject",
 			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
-				msg.On("Respond", []byte("OK")).Return(assert.AnError).Once()
+				msg.On("Respond", successReply()).Return(assert.AnError).Once()
 
 				// Mock the Read and Write operations
 				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
@@ -411,7 +462,7 @@ func TestProjectDeleteAllAccessHandler(t *testing.T) {
 
 			// Test that the function doesn't panic
 			assert.NotPanics(t, func() {
-				err := handlerService.projectDeleteAllAccessHandler(msg)
+				err := handlerService.projectDeleteAllAccessHandler(context.Background(), msg)
 				if tt.expectedError {
 					assert.Error(t, err)
 				} else {
@@ -430,6 +481,89 @@ func TestProjectDeleteAllAccessHandler(t *testing.T) {
 	}
 }
 
+// TestProjectAccessHandlersDryRun tests that dry-run subjects reply with the
+// planned tuples without writing to OpenFGA.
+func TestProjectAccessHandlersDryRun(t *testing.T) {
+	tests := []struct {
+		name            string
+		subject         string
+		header          nats.Header
+		messageData     []byte
+		existing        []openfga.Tuple
+		handler         func(*HandlerService, context.Context, INatsMsg) error
+		expectedWrites  int
+		expectedDeletes int
+	}{
+		{
+			name:    "update dry run",
+			subject: "lfx.update_access_dryrun.project",
+			messageData: mustJSON(projectStub{
+				UID:     "dry-run-project",
+				Public:  true,
+				Writers: []string{"user1"},
+			}),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:user2", Relation: "writer", Object: "project:dry-run-project"}},
+			},
+			handler:         (*HandlerService).projectUpdateAccessHandler,
+			expectedWrites:  2,
+			expectedDeletes: 1,
+		},
+		{
+			name:        "delete all dry run",
+			subject:     "lfx.delete_all_access_dryrun.project",
+			messageData: []byte("dry-run-project"),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:user2", Relation: "writer", Object: "project:dry-run-project"}},
+				{Key: openfga.TupleKey{User: "user:*", Relation: "viewer", Object: "project:dry-run-project"}},
+			},
+			handler:         (*HandlerService).projectDeleteAllAccessHandler,
+			expectedWrites:  0,
+			expectedDeletes: 2,
+		},
+		{
+			name:        "dry-run header",
+			subject:     "lfx.delete_all_access.project",
+			header:      nats.Header{"dry-run": {"true"}},
+			messageData: []byte("dry-run-project"),
+			existing: []openfga.Tuple{
+				{Key: openfga.TupleKey{User: "user:user2", Relation: "writer", Object: "project:dry-run-project"}},
+			},
+			handler:         (*HandlerService).projectDeleteAllAccessHandler,
+			expectedWrites:  0,
+			expectedDeletes: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			msg.subject = tt.subject
+			msg.header = tt.header
+
+			handlerService := setupService()
+			handlerService.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).Return(&ClientReadResponse{
+				Tuples: tt.existing,
+			}, nil).Once()
+
+			var reply syncResult
+			msg.On("Respond", mock.Anything).Run(func(args mock.Arguments) {
+				assert.NoError(t, json.Unmarshal(args.Get(0).([]byte), &reply))
+			}).Return(nil).Once()
+
+			assert.NoError(t, tt.handler(handlerService, context.Background(), msg))
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertNotCalled(t, "Write", mock.Anything, mock.Anything)
+			assert.Equal(t, "project:dry-run-project", reply.Object)
+			assert.True(t, reply.DryRun)
+			assert.Len(t, reply.Writes, tt.expectedWrites)
+			assert.Len(t, reply.Deletes, tt.expectedDeletes)
+		})
+	}
+}
+
 // Helper function to create JSON or panic
 func mustJSON(v any) []byte {
 	data, err := json.Marshal(v)
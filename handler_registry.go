@@ -0,0 +1,202 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+)
+
+// objectTypeConfig describes an object type whose access is synced by the
+// generic update and delete handlers, using the standard access payload.
+type objectTypeConfig struct {
+	// Type is the OpenFGA object type, e.g. "committee".
+	Type string `json:"type"`
+	// Relations are the relations that may be set in the "relations" of an
+	// update. An empty list allows any relation.
+	Relations []string `json:"relations"`
+	// References maps the relations that may be set in the "references" of an
+	// update to the object type they reference, e.g. "project": "project". An
+	// empty map allows any reference.
+	References map[string]string `json:"references"`
+	// OwnedRelations are the relations replaced by a full update. Tuples with
+	// other relations, such as memberships managed by their own subjects, are
+	// kept. An empty list means the update owns every relation of the object.
+	OwnedRelations []string `json:"owned_relations"`
+}
+
+// defaultObjectTypes is the object type registry used when OBJECT_TYPES_CONFIG
+// is not set. Meeting registrants, and committee, mailing list and team members
+// are managed by their own subjects, so updates do not own their relations.
+const defaultObjectTypes = `[
+	{
+		"type": "project",
+		"references": {"parent": "project"}
+	},
+	{
+		"type": "meeting",
+		"relations": ["organizer", "viewer"],
+		"references": {"project": "project", "committee": "committee"},
+		"owned_relations": ["organizer", "viewer", "project", "committee"]
+	},
+	{
+		"type": "committee",
+		"owned_relations": ["owner", "writer", "auditor", "viewer", "project", "parent"]
+	},
+	{"type": "groupsio_service"},
+	{
+		"type": "groupsio_mailing_list",
+		"relations": ["owner", "writer", "auditor", "viewer"],
+		"references": {"parent": "groupsio_service", "project": "project"},
+		"owned_relations": ["owner", "writer", "auditor", "viewer", "parent", "project"]
+	},
+	{
+		"type": "team",
+		"relations": ["writer", "auditor", "viewer"],
+		"references": {"project": "project", "parent": "team"},
+		"owned_relations": ["writer", "auditor", "viewer", "project", "parent"]
+	}
+]`
+
+// objectTypes is the registry of object types served by the generic handlers,
+// in the order they are subscribed.
+var objectTypes []objectTypeConfig
+
+// loadObjectTypes loads the object type registry from the OBJECT_TYPES_CONFIG
+// environment variable (a JSON list of object types), or the default registry.
+func loadObjectTypes() error {
+	config := os.Getenv("OBJECT_TYPES_CONFIG")
+	if config == "" {
+		config = defaultObjectTypes
+	}
+
+	var registry []objectTypeConfig
+	if err := json.Unmarshal([]byte(config), &registry); err != nil {
+		return fmt.Errorf("invalid OBJECT_TYPES_CONFIG: %w", err)
+	}
+
+	seen := make(map[string]bool, len(registry))
+	for _, objType := range registry {
+		if objType.Type == "" {
+			return errors.New("invalid OBJECT_TYPES_CONFIG: object type without a name")
+		}
+		if seen[objType.Type] {
+			return fmt.Errorf("invalid OBJECT_TYPES_CONFIG: duplicate object type %q", objType.Type)
+		}
+		seen[objType.Type] = true
+	}
+
+	objectTypes = registry
+	return nil
+}
+
+// lookupObjectType returns the registry entry of an object type, or nil if the
+// type is not registered.
+func lookupObjectType(objectType string) *objectTypeConfig {
+	for i := range objectTypes {
+		if objectTypes[i].Type == objectType {
+			return &objectTypes[i]
+		}
+	}
+	return nil
+}
+
+// referenceType returns the object type referenced by a reference relation of
+// an object type. Unregistered references of the "parent" relation reference
+// the object's own type, and any other reference is named after its type.
+func referenceType(objectType, reference string) string {
+	if objType := lookupObjectType(objectType); objType != nil {
+		if refType, ok := objType.References[reference]; ok {
+			return refType
+		}
+	}
+	if reference == constants.RelationParent {
+		return objectType
+	}
+	return reference
+}
+
+// ownedRelations returns the relations replaced by a full update of an object
+// type, or nil if the update owns every relation.
+func ownedRelations(objectType string) []string {
+	if objType := lookupObjectType(objectType); objType != nil {
+		return objType.OwnedRelations
+	}
+	return nil
+}
+
+// validateStandardAccess checks the relations and references of a standard
+// access payload against the registry. Unregistered types are not validated.
+func validateStandardAccess(obj *standardAccessStub) error {
+	objType := lookupObjectType(obj.ObjectType)
+	if objType == nil {
+		return nil
+	}
+
+	if len(objType.Relations) > 0 {
+		for relation := range obj.Relations {
+			if !slices.Contains(objType.Relations, relation) {
+				return fmt.Errorf("relation %q is not allowed on %s", relation, obj.ObjectType)
+			}
+		}
+	}
+
+	if len(objType.References) > 0 {
+		for reference := range obj.References {
+			if _, ok := objType.References[reference]; !ok {
+				return fmt.Errorf("reference %q is not allowed on %s", reference, obj.ObjectType)
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateAccessHandler returns the access control update handler of a
+// registered object type.
+func (h *HandlerService) updateAccessHandler(objectType string) HandlerFunc {
+	return func(ctx context.Context, message INatsMsg) error {
+		start := time.Now()
+
+		// Parse the event data.
+		obj := new(standardAccessStub)
+		err := json.Unmarshal(message.Data(), obj)
+		if err != nil {
+			logger.With(errKey, err, "object_type", objectType).ErrorContext(ctx, "event data parse error")
+			return h.replySync(ctx, message, start, nil, newHandlerError(errCodeInvalidPayload, err))
+		}
+
+		// The object type comes from the subject, and may be repeated in the
+		// payload.
+		switch obj.ObjectType {
+		case "":
+			obj.ObjectType = objectType
+		case objectType:
+		default:
+			logger.With("object_type", obj.ObjectType).ErrorContext(ctx, "unexpected "+objectType+" object type")
+			return h.replySync(
+				ctx, message, start, nil,
+				newHandlerError(errCodeInvalidPayload, errors.New("unexpected object type "+obj.ObjectType)),
+			)
+		}
+
+		return h.processStandardAccessUpdate(ctx, message, obj)
+	}
+}
+
+// deleteAllAccessHandler returns the access control deletion handler of a
+// registered object type.
+func (h *HandlerService) deleteAllAccessHandler(objectType string) HandlerFunc {
+	return func(ctx context.Context, message INatsMsg) error {
+		return h.processDeleteAllAccessMessage(ctx, message, objectType+":", objectType)
+	}
+}
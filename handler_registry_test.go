@@ -0,0 +1,236 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestLoadObjectTypes tests the loadObjectTypes function
+func TestLoadObjectTypes(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		expectedTypes []string
+		expectedError bool
+	}{
+		{
+			name:          "default registry",
+			config:        "",
+			expectedTypes: []string{"project", "meeting", "committee", "groupsio_service", "groupsio_mailing_list", "team"},
+		},
+		{
+			name:          "custom registry",
+			config:        `[{"type": "committee"}, {"type": "survey", "relations": ["writer"]}]`,
+			expectedTypes: []string{"committee", "survey"},
+		},
+		{
+			name:          "invalid JSON",
+			config:        `{"type": "committee"}`,
+			expectedError: true,
+		},
+		{
+			name:          "missing type name",
+			config:        `[{"relations": ["writer"]}]`,
+			expectedError: true,
+		},
+		{
+			name:          "duplicate type",
+			config:        `[{"type": "committee"}, {"type": "committee"}]`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedTypes := objectTypes
+			defer func() {
+				objectTypes = savedTypes
+			}()
+			t.Setenv("OBJECT_TYPES_CONFIG", tt.config)
+
+			err := loadObjectTypes()
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var types []string
+			for _, objType := range objectTypes {
+				types = append(types, objType.Type)
+			}
+			assert.Equal(t, tt.expectedTypes, types)
+		})
+	}
+}
+
+// TestValidateStandardAccess tests the validateStandardAccess function
+func TestValidateStandardAccess(t *testing.T) {
+	tests := []struct {
+		name          string
+		obj           *standardAccessStub
+		expectedError bool
+	}{
+		{
+			name: "allowed relations and references",
+			obj: &standardAccessStub{
+				ObjectType: "team",
+				Relations:  map[string][]string{"writer": {"alice"}},
+				References: map[string]referenceList{"project": {{ID: "project-123"}}},
+			},
+		},
+		{
+			name: "relation not allowed",
+			obj: &standardAccessStub{
+				ObjectType: "team",
+				Relations:  map[string][]string{"member": {"alice"}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "reference not allowed",
+			obj: &standardAccessStub{
+				ObjectType: "team",
+				References: map[string]referenceList{"committee": {{ID: "committee-123"}}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "registered type without restrictions",
+			obj: &standardAccessStub{
+				ObjectType: "committee",
+				Relations:  map[string][]string{"anything": {"alice"}},
+			},
+		},
+		{
+			name: "unregistered type",
+			obj: &standardAccessStub{
+				ObjectType: "unknown",
+				Relations:  map[string][]string{"anything": {"alice"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStandardAccess(tt.obj)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestUpdateAccessHandler tests the handler of a registered object type
+func TestUpdateAccessHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		messageData   []byte
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name: "object type defaults to the registered type",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "team-123",
+				References: map[string]referenceList{"parent": {{ID: "team-456"}}},
+				Relations:  map[string][]string{"writer": {"alice"}},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "team:team-123"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: []openfga.Tuple{}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					if len(req.Writes) != 2 || len(req.Deletes) != 0 {
+						return false
+					}
+					for _, tuple := range req.Writes {
+						if tuple.Relation == "parent" && tuple.User != "team:team-456" {
+							return false
+						}
+					}
+					return true
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name: "relations not owned by the update are kept",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "team-123",
+				Relations: map[string][]string{"writer": {"alice"}},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: []openfga.Tuple{
+						{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "team:team-123"}},
+						{Key: openfga.TupleKey{User: "user:bob", Relation: "writer", Object: "team:team-123"}},
+						{Key: openfga.TupleKey{User: "user:carol", Relation: "member", Object: "team:team-123"}},
+					}}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:bob"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+		},
+		{
+			name: "relation not allowed",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "team-123",
+				Relations: map[string][]string{"member": {"alice"}},
+			}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "unexpected object type",
+			messageData: mustJSON(standardAccessStub{UID: "team-123", ObjectType: "committee"}),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "invalid JSON",
+			messageData: []byte("{invalid"),
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			msg.subject = "lfx.update_access.team"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			err := handlerService.updateAccessHandler("team")(context.Background(), msg)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+)
+
+// relationOperation defines the type of operation to perform on the relations
+// of an object.
+type relationOperation int
+
+const (
+	relationAdd relationOperation = iota
+	relationRemove
+)
+
+// relationObjectType returns the object type addressed by a relation add or
+// remove subject, e.g. "committee" for "lfx.add_relation.committee".
+func relationObjectType(subject string) string {
+	switch {
+	case strings.HasPrefix(subject, constants.AddRelationSubjectPrefix):
+		return strings.TrimPrefix(subject, constants.AddRelationSubjectPrefix)
+	case strings.HasPrefix(subject, constants.RemoveRelationSubjectPrefix):
+		return strings.TrimPrefix(subject, constants.RemoveRelationSubjectPrefix)
+	default:
+		return ""
+	}
+}
+
+// processRelationMessage handles adding or removing individual relations of an
+// object. The payload uses the standard access format, but unlike a full
+// update, only the listed relations are changed and every other tuple on the
+// object is left untouched.
+func (h *HandlerService) processRelationMessage(
+	ctx context.Context,
+	message INatsMsg,
+	operation relationOperation,
+) (err error) {
+	result := new(syncResult)
+	defer func(start time.Time) {
+		err = h.replySync(ctx, message, start, result, err)
+	}(time.Now())
+
+	// Log the operation type
+	operationType := "add"
+	if operation == relationRemove {
+		operationType = "remove"
+	}
+
+	logger.With("message", string(message.Data())).InfoContext(ctx, "handling relation "+operationType)
+
+	// Parse the event data.
+	obj := new(standardAccessStub)
+	err = json.Unmarshal(message.Data(), obj)
+	if err != nil {
+		logger.With(errKey, err).ErrorContext(ctx, "event data parse error")
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+
+	// The object type comes from the subject, and may be repeated in the payload.
+	objectType := relationObjectType(message.Subject())
+	switch {
+	case obj.ObjectType == "":
+		obj.ObjectType = objectType
+	case obj.ObjectType != objectType:
+		logger.With("object_type", obj.ObjectType, "subject", message.Subject()).ErrorContext(ctx, "object type mismatch")
+		return newHandlerError(
+			errCodeInvalidPayload,
+			fmt.Errorf("object type %q does not match subject %q", obj.ObjectType, message.Subject()),
+		)
+	}
+	if obj.ObjectType == "" {
+		logger.ErrorContext(ctx, "object type not found")
+		return newHandlerError(errCodeInvalidPayload, errors.New("object type not found"))
+	}
+
+	if obj.UID == "" {
+		logger.ErrorContext(ctx, obj.ObjectType+" ID not found")
+		return newHandlerError(errCodeMissingUID, errors.New(obj.ObjectType+" ID not found"))
+	}
+
+	object := obj.ObjectType + ":" + obj.UID
+	result.Object = object
+
+	if err = validateStandardAccess(obj); err != nil {
+		logger.With(errKey, err, "object", object).ErrorContext(ctx, "invalid relation "+operationType)
+		return newHandlerError(errCodeInvalidPayload, err)
+	}
+
+	tuples := h.buildStandardAccessTuples(object, obj)
+
+	if err = authzModel.validateTuples(object, tuples); err != nil {
+		logger.With(errKey, err, "object", object).
+			ErrorContext(ctx, "relation "+operationType+" does not match the authorization model")
+		return newHandlerError(errCodeSchemaViolation, err)
+	}
+
+	if operation == relationRemove {
+		result.Writes, result.Deletes, err = h.patchObjectTuples(ctx, message, object, nil, tuples)
+	} else {
+		result.Writes, result.Deletes, err = h.patchObjectTuples(ctx, message, object, tuples, nil)
+	}
+	if err != nil {
+		logger.With(errKey, err, "tuples", tuples, "object", object).
+			ErrorContext(ctx, "failed to "+operationType+" relations")
+		return newHandlerError(errCodeUpstream, err)
+	}
+
+	logger.With(
+		"tuples", tuples,
+		"object", object,
+		"writes", result.Writes,
+		"deletes", result.Deletes,
+	).InfoContext(ctx, "patched tuples")
+
+	return nil
+}
+
+// addRelationHandler handles adding relations to an object of any type.
+func (h *HandlerService) addRelationHandler(ctx context.Context, message INatsMsg) error {
+	return h.processRelationMessage(ctx, message, relationAdd)
+}
+
+// removeRelationHandler handles removing relations from an object of any type.
+func (h *HandlerService) removeRelationHandler(ctx context.Context, message INatsMsg) error {
+	return h.processRelationMessage(ctx, message, relationRemove)
+}
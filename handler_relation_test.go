@@ -0,0 +1,183 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestRelationHandlers tests the addRelationHandler and removeRelationHandler functions
+func TestRelationHandlers(t *testing.T) {
+	existing := []openfga.Tuple{
+		{Key: openfga.TupleKey{User: "user:alice", Relation: "writer", Object: "committee:committee-123"}},
+		{Key: openfga.TupleKey{User: "user:bob", Relation: "auditor", Object: "committee:committee-123"}},
+	}
+
+	tests := []struct {
+		name           string
+		subject        string
+		messageData    []byte
+		setupMocks     func(*HandlerService, *MockNatsMsg)
+		operation      relationOperation
+		expectedError  bool
+		expectedCalled bool
+	}{
+		{
+			name:    "add writes only missing relations",
+			subject: "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"writer": {"alice", "carol"}},
+			}),
+			operation: relationAdd,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.MatchedBy(func(req ClientReadRequest) bool {
+					return req.Object != nil && *req.Object == "committee:committee-123"
+				}), mock.Anything).Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:carol" && req.Writes[0].Relation == "writer"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name:    "add with matching object type in payload",
+			subject: "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "committee-123",
+				ObjectType: "committee",
+				Public:     true,
+			}),
+			operation: relationAdd,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:*" && req.Writes[0].Relation == "viewer"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name:    "add existing relations is a no-op",
+			subject: "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"writer": {"alice"}, "auditor": {"bob"}},
+			}),
+			operation: relationAdd,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				// No Write operation expected.
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name:    "remove deletes only existing relations",
+			subject: "lfx.remove_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"auditor": {"bob", "dave"}},
+			}),
+			operation: relationRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 &&
+						req.Deletes[0].User == "user:bob" && req.Deletes[0].Relation == "auditor"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError:  false,
+			expectedCalled: true,
+		},
+		{
+			name:    "object type mismatch",
+			subject: "lfx.remove_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:        "committee-123",
+				ObjectType: "project",
+			}),
+			operation: relationRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
+		},
+		{
+			name:        "missing UID",
+			subject:     "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{Relations: map[string][]string{"writer": {"alice"}}}),
+			operation:   relationAdd,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
+		},
+		{
+			name:    "read operation fails",
+			subject: "lfx.add_relation.committee",
+			messageData: mustJSON(standardAccessStub{
+				UID:       "committee-123",
+				Relations: map[string][]string{"writer": {"alice"}},
+			}),
+			operation: relationAdd,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), assert.AnError).Once()
+			},
+			expectedError:  true,
+			expectedCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+			msg.subject = tt.subject
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			// Test that the function doesn't panic
+			assert.NotPanics(t, func() {
+				err := handlerService.processRelationMessage(context.Background(), msg, tt.operation)
+				if tt.expectedError {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+
+			// Verify mock expectations
+			if tt.expectedCalled {
+				msg.AssertExpectations(t)
+			} else {
+				msg.AssertNotCalled(t, "Respond")
+			}
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
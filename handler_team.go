@@ -0,0 +1,29 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+// The fga-sync service.
+package main
+
+import (
+	"context"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+)
+
+// teamMembers describes the members of a team.
+var teamMembers = memberType{
+	name:       "team",
+	objectType: constants.ObjectTypeTeam,
+	relations:  []string{constants.RelationMember},
+	uid:        func(member *memberStub) string { return member.TeamUID },
+}
+
+// teamMemberPutHandler handles putting a member to a team (idempotent create).
+func (h *HandlerService) teamMemberPutHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, teamMembers, memberPut)
+}
+
+// teamMemberRemoveHandler handles removing a member from a team.
+func (h *HandlerService) teamMemberRemoveHandler(ctx context.Context, message INatsMsg) error {
+	return h.processMemberMessage(ctx, message, teamMembers, memberRemove)
+}
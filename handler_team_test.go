@@ -0,0 +1,163 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	. "github.com/openfga/go-sdk/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestTeamMemberHandlers tests the teamMemberPutHandler and teamMemberRemoveHandler functions
+func TestTeamMemberHandlers(t *testing.T) {
+	existing := []openfga.Tuple{
+		{Key: openfga.TupleKey{User: "user:alice", Relation: "member", Object: "team:team-123"}},
+	}
+
+	tests := []struct {
+		name          string
+		messageData   []byte
+		operation     memberOperation
+		setupMocks    func(*HandlerService, *MockNatsMsg)
+		expectedError bool
+	}{
+		{
+			name:        "put new member",
+			messageData: mustJSON(memberStub{Username: "bob", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && len(req.Deletes) == 0 &&
+						req.Writes[0].User == "user:bob" && req.Writes[0].Relation == "member" &&
+						req.Writes[0].Object == "team:team-123"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError: false,
+		},
+		{
+			name:        "put nested team",
+			messageData: mustJSON(memberStub{Username: "team:team-456#member", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 1 && req.Writes[0].User == "team:team-456#member"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError: false,
+		},
+		{
+			name:        "put existing member is a no-op",
+			messageData: mustJSON(memberStub{Username: "alice", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				// No Write operation expected.
+			},
+			expectedError: false,
+		},
+		{
+			name:        "remove existing member",
+			messageData: mustJSON(memberStub{Username: "alice", TeamUID: "team-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Write", mock.Anything, mock.MatchedBy(func(req ClientWriteRequest) bool {
+					return len(req.Writes) == 0 && len(req.Deletes) == 1 && req.Deletes[0].User == "user:alice"
+				})).Return(&ClientWriteResponse{}, nil).Once()
+			},
+			expectedError: false,
+		},
+		{
+			name:        "remove missing member is a no-op",
+			messageData: mustJSON(memberStub{Username: "bob", TeamUID: "team-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", successReply()).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return(&ClientReadResponse{Tuples: existing}, nil).Once()
+			},
+			expectedError: false,
+		},
+		{
+			name:        "unsupported relation",
+			messageData: mustJSON(memberStub{Username: "bob", Relation: "writer", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeInvalidPayload)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing team UID",
+			messageData: mustJSON(memberStub{Username: "bob"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "missing username",
+			messageData: mustJSON(memberStub{TeamUID: "team-123"}),
+			operation:   memberRemove,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeMissingUID)).Return(nil).Once()
+			},
+			expectedError: true,
+		},
+		{
+			name:        "read operation fails",
+			messageData: mustJSON(memberStub{Username: "bob", TeamUID: "team-123"}),
+			operation:   memberPut,
+			setupMocks: func(service *HandlerService, msg *MockNatsMsg) {
+				msg.On("Respond", errorReply(errCodeUpstream)).Return(nil).Once()
+				service.fgaService.client.(*MockFgaClient).On("Read", mock.Anything, mock.Anything, mock.Anything).
+					Return((*ClientReadResponse)(nil), assert.AnError).Once()
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := CreateMockNatsMsg(tt.messageData)
+			msg.reply = "reply.subject"
+
+			handlerService := setupService()
+			tt.setupMocks(handlerService, msg)
+			handlerService.fgaService.cacheBucket.(*MockKeyValue).On("Put", mock.Anything, "inv", mock.Anything).Return(uint64(1), nil).Maybe()
+
+			var err error
+			if tt.operation == memberRemove {
+				msg.subject = "lfx.remove_member.team"
+				err = handlerService.teamMemberRemoveHandler(context.Background(), msg)
+			} else {
+				msg.subject = "lfx.put_member.team"
+				err = handlerService.teamMemberPutHandler(context.Background(), msg)
+			}
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg.AssertExpectations(t)
+			handlerService.fgaService.client.(*MockFgaClient).AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+)
+
+// echoedHeaders are the request headers copied to the reply.
+var echoedHeaders = []string{
+	constants.RequestIDHeader,
+	constants.TraceparentHeader,
+	constants.TracestateHeader,
+}
+
+// headerValue returns the first value of a header, whatever the case of its
+// name. [nats.Header.Get] is case-sensitive, while publishers may send e.g.
+// "Traceparent" or "request-id".
+func headerValue(header nats.Header, name string) string {
+	if values := header[name]; len(values) > 0 {
+		return values[0]
+	}
+	for key, values := range header {
+		if len(values) > 0 && strings.EqualFold(key, name) {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// echoHeaders returns the headers of a reply to a request with the given
+// headers, or nil if there are none to echo.
+func echoHeaders(header nats.Header) nats.Header {
+	var echoed nats.Header
+	for _, name := range echoedHeaders {
+		if value := headerValue(header, name); value != "" {
+			if echoed == nil {
+				echoed = nats.Header{}
+			}
+			echoed.Set(name, value)
+		}
+	}
+	return echoed
+}
+
+// traceID returns the trace ID of a W3C traceparent header value, of the form
+// "00-<trace ID>-<parent ID>-<flags>", or an empty string if it is malformed.
+func traceID(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ""
+	}
+	return parts[1]
+}
+
+// messageLogAttrs returns the attributes added to the log lines of a message:
+// its subject, and the request ID, trace ID, tenant ID and content type from
+// its headers when present.
+func messageLogAttrs(message INatsMsg) []slog.Attr {
+	attrs := []slog.Attr{slog.String("subject", message.Subject())}
+	header := message.Header()
+	for key, value := range map[string]string{
+		"request_id":   headerValue(header, constants.RequestIDHeader),
+		"trace_id":     traceID(headerValue(header, constants.TraceparentHeader)),
+		"tenant_id":    headerValue(header, constants.TenantIDHeader),
+		"content_type": headerValue(header, constants.ContentTypeHeader),
+	} {
+		if value != "" {
+			attrs = append(attrs, slog.String(key, value))
+		}
+	}
+	return attrs
+}
+
+// logAttrsKey is the context key of the attributes added to every log line
+// written with the context.
+type logAttrsKey struct{}
+
+// withLogAttrs returns a context whose log lines have the given attributes, on
+// top of those of the parent context.
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(parent[:len(parent):len(parent)], attrs...))
+}
+
+// contextHandler is a [slog.Handler] adding the attributes of the context,
+// such as the request ID of the message being handled, to each log line.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements [slog.Handler.Handle].
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements [slog.Handler.WithAttrs].
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements [slog.Handler.WithGroup].
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,103 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// TestHeaderValue tests the headerValue function
+func TestHeaderValue(t *testing.T) {
+	header := nats.Header{
+		"Traceparent": {testTraceparent},
+		"request-id":  {"req-1", "req-2"},
+		"Tenant-Id":   {},
+	}
+
+	assert.Equal(t, testTraceparent, headerValue(header, constants.TraceparentHeader))
+	assert.Equal(t, "req-1", headerValue(header, constants.RequestIDHeader))
+	assert.Empty(t, headerValue(header, constants.TenantIDHeader))
+	assert.Empty(t, headerValue(nil, constants.RequestIDHeader))
+}
+
+// TestEchoHeaders tests the echoHeaders function
+func TestEchoHeaders(t *testing.T) {
+	echoed := echoHeaders(nats.Header{
+		"request-id":  {"req-1"},
+		"traceparent": {testTraceparent},
+		"Tenant-Id":   {"tenant-1"},
+	})
+	assert.Equal(t, nats.Header{
+		constants.RequestIDHeader:   {"req-1"},
+		constants.TraceparentHeader: {testTraceparent},
+	}, echoed)
+
+	assert.Nil(t, echoHeaders(nats.Header{"Tenant-Id": {"tenant-1"}}))
+	assert.Nil(t, echoHeaders(nil))
+}
+
+// TestTraceID tests the traceID function
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		want        string
+	}{
+		{name: "valid", traceparent: testTraceparent, want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "empty", traceparent: ""},
+		{name: "short trace ID", traceparent: "00-4bf92f35-00f067aa0ba902b7-01"},
+		{name: "missing flags", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, traceID(tt.traceparent))
+		})
+	}
+}
+
+// TestContextHandler tests that log lines carry the attributes of the message
+// being handled.
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)})
+
+	msg := CreateMockNatsMsg(nil)
+	msg.subject = constants.ProjectUpdateAccessSubject
+	msg.header = nats.Header{
+		constants.RequestIDHeader:   {"req-1"},
+		constants.TraceparentHeader: {testTraceparent},
+		constants.TenantIDHeader:    {"tenant-1"},
+		constants.ContentTypeHeader: {"application/json"},
+	}
+	ctx := withLogAttrs(context.Background(), messageLogAttrs(msg)...)
+	log.With("object", "project:1").InfoContext(ctx, "synced tuples")
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "synced tuples", line["msg"])
+	assert.Equal(t, "project:1", line["object"])
+	assert.Equal(t, constants.ProjectUpdateAccessSubject, line["subject"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line["trace_id"])
+	assert.Equal(t, "tenant-1", line["tenant_id"])
+	assert.Equal(t, "application/json", line["content_type"])
+
+	// Without message attributes, log lines are unchanged.
+	buf.Reset()
+	log.Info("started")
+	line = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.NotContains(t, line, "subject")
+}
@@ -0,0 +1,290 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// jetstreamMaxDeliver is the number of times a message is delivered before
+	// it is dead-lettered. The consumer itself redelivers without limit, so
+	// that a message is kept if it cannot be dead-lettered.
+	jetstreamMaxDeliver = 10
+	// jetstreamAckWait is how long a delivered message may be handled before
+	// it is redelivered.
+	jetstreamAckWait = 30 * time.Second
+	// jetstreamNakBaseDelay is the redelivery delay after the first failure,
+	// doubled after each further failure.
+	jetstreamNakBaseDelay = time.Second
+	// jetstreamNakMaxDelay is the longest redelivery delay.
+	jetstreamNakMaxDelay = 2 * time.Minute
+)
+
+// jetstreamProgressInterval is how often a message waiting for a worker is
+// reported in progress, so that it is not redelivered past its ack wait.
+var jetstreamProgressInterval = jetstreamAckWait / 3
+
+var (
+	// useJetStream enables consuming the update and delete subjects from a
+	// JetStream stream instead of core NATS queue subscriptions.
+	useJetStream bool
+	// syncStreamName is the name of the JetStream stream of the update and
+	// delete subjects.
+	syncStreamName string
+	// consumeContexts are the running JetStream consumers, stopped on shutdown.
+	consumeContexts []jetstream.ConsumeContext
+)
+
+func init() {
+	useJetStream = os.Getenv("USE_JETSTREAM") == "true"
+	syncStreamName = os.Getenv("SYNC_STREAM")
+	if syncStreamName == "" {
+		syncStreamName = constants.SyncStreamName
+	}
+}
+
+// JetStreamMsg is a wrapper around [jetstream.Msg] that implements [INatsMsg].
+// Messages stored in a stream have no reply inbox: the publisher was answered
+// with the stream's publish acknowledgement.
+type JetStreamMsg struct {
+	jetstream.Msg
+}
+
+// Reply implements [INatsMsg.Reply].
+func (m *JetStreamMsg) Reply() string {
+	return ""
+}
+
+// Respond implements [INatsMsg.Respond].
+func (m *JetStreamMsg) Respond(_ []byte) error {
+	return nil
+}
+
+// Header implements [INatsMsg.Header].
+func (m *JetStreamMsg) Header() nats.Header {
+	return m.Headers()
+}
+
+// isSyncSubject reports whether a subject changes access, and is consumed
+// from the stream when JetStream is enabled and dead-lettered on failure.
+// Access checks need a reply, and dry runs have no effect worth retrying, so
+// they stay on core NATS.
+func isSyncSubject(subject string) bool {
+	return subject != constants.AccessCheckSubject &&
+		!strings.HasPrefix(subject, constants.DeadLetterAdminSubjectPrefix) &&
+		!strings.HasPrefix(subject, constants.UpdateAccessDryRunSubjectPrefix) &&
+		!strings.HasPrefix(subject, constants.DeleteAllAccessDryRunSubjectPrefix)
+}
+
+// consumerName returns the durable consumer name of a subject, which may not
+// contain dots or wildcards.
+func consumerName(subject string) string {
+	name := strings.ReplaceAll(subject, "*", "all")
+	name = strings.ReplaceAll(name, ".", "_")
+	return constants.FgaSyncConsumerPrefix + name
+}
+
+// createSyncStream creates or updates the work queue stream of the given
+// subjects.
+func createSyncStream(ctx context.Context, subjects []string) (jetstream.Stream, error) {
+	stream, err := jetstreamConn.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        syncStreamName,
+		Description: "FGA sync update and delete requests",
+		Subjects:    subjects,
+		Retention:   jetstream.WorkQueuePolicy,
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		logger.Error("error creating JetStream stream",
+			errKey, err,
+			"stream", syncStreamName,
+		)
+		return nil, err
+	}
+	logger.Info("JetStream stream ready",
+		"stream", syncStreamName,
+		"subjects", subjects,
+	)
+	return stream, nil
+}
+
+// consumeSubject consumes a subject of the stream through a durable pull
+// consumer, which is shared by the replicas of the service. Messages are
+// handled by the worker pool of the subject, and only as many are pulled as it
+// has workers. Messages waiting in its queue are reported in progress, so that
+// they are not redelivered to another replica while they wait.
+func consumeSubject(
+	ctx context.Context,
+	stream jetstream.Stream,
+	subject, description string,
+	handler HandlerFunc,
+) error {
+	name := consumerName(subject)
+	pool := addWorkerPool(subject)
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       name,
+		Description:   description,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       jetstreamAckWait,
+	})
+	if err != nil {
+		logger.Error("error creating JetStream consumer",
+			errKey, err,
+			"subject", subject,
+			"consumer", name,
+		)
+		return err
+	}
+
+	consumeContext, err := consumer.Consume(func(msg jetstream.Msg) {
+		// Update pools are ordered, and wait for room in the queue.
+		handling := keepInProgress(msg)
+		pool.submit(msg.Data(), func() {
+			handling()
+			handleJetStreamMsg(msg, description, handler)
+		})
+	}, jetstream.PullMaxMessages(subjectLimits(subject).workers))
+	if err != nil {
+		logger.Error("error consuming JetStream consumer",
+			errKey, err,
+			"subject", subject,
+			"consumer", name,
+		)
+		return err
+	}
+	consumeContexts = append(consumeContexts, consumeContext)
+
+	logger.Info("consuming JetStream subject",
+		"subject", subject,
+		"stream", syncStreamName,
+		"consumer", name,
+	)
+	return nil
+}
+
+// keepInProgress reports a message in progress every
+// [jetstreamProgressInterval] until the returned function is called, when a
+// worker starts handling it. The ack wait then starts again, so that the
+// handler deadline, which starts at the same time, ends within it.
+func keepInProgress(msg jetstream.Msg) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(jetstreamProgressInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				reportInProgress(msg)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		reportInProgress(msg)
+	}
+}
+
+// reportInProgress resets the ack wait of a message.
+func reportInProgress(msg jetstream.Msg) {
+	if err := msg.InProgress(); err != nil {
+		logger.With(errKey, err, "subject", msg.Subject()).Warn("error reporting JetStream message in progress")
+	}
+}
+
+// handleJetStreamMsg handles a message of the stream. It is acknowledged after
+// it is handled successfully. Messages that cannot succeed, such as invalid
+// payloads, and messages that failed jetstreamMaxDeliver times are
+// dead-lettered and terminated. Other failures are redelivered with a backoff.
+func handleJetStreamMsg(msg jetstream.Msg, description string, handler HandlerFunc) {
+	message := &JetStreamMsg{msg}
+	ctx, cancel := handlerContext(message, time.Now())
+	defer cancel()
+	errHandler := handler(ctx, message)
+	if errHandler == nil {
+		if err := msg.Ack(); err != nil {
+			logger.With(errKey, err, "subject", msg.Subject()).Error("error acknowledging JetStream message")
+		}
+		return
+	}
+
+	var delivered uint64 = 1
+	receivedAt := time.Now()
+	if metadata, err := msg.Metadata(); err == nil {
+		delivered = metadata.NumDelivered
+		receivedAt = metadata.Timestamp
+	}
+	logger.ErrorContext(ctx, "error handling "+description+" request",
+		errKey, errHandler,
+		"delivered", delivered,
+	)
+
+	// While OpenFGA is unavailable, the message is kept until the circuit
+	// breaker lets calls through again, however many times it was delivered.
+	if errors.Is(errHandler, errCircuitOpen) {
+		if err := msg.NakWithDelay(max(fgaBreaker.RetryAfter(), jetstreamNakBaseDelay)); err != nil {
+			logger.With(errKey, err, "subject", msg.Subject()).Error("error rejecting JetStream message")
+		}
+		return
+	}
+
+	if isPermanentError(errHandler) || delivered >= jetstreamMaxDeliver {
+		err := deadLetters.add(
+			context.Background(), msg.Subject(), msg.Data(), msg.Headers(), errHandler, delivered, receivedAt,
+		)
+		if err == nil {
+			if err = msg.TermWithReason(errorCode(errHandler)); err != nil {
+				logger.With(errKey, err, "subject", msg.Subject()).Error("error terminating JetStream message")
+			}
+			return
+		}
+		// Keep the message, to dead-letter it on a later delivery.
+	}
+
+	if err := msg.NakWithDelay(nakDelay(delivered)); err != nil {
+		logger.With(errKey, err, "subject", msg.Subject()).Error("error rejecting JetStream message")
+	}
+}
+
+// isPermanentError reports whether a handler error would fail again on
+// redelivery.
+func isPermanentError(err error) bool {
+	switch errorCode(err) {
+	case errCodeInvalidPayload, errCodeMissingUID, errCodeSchemaViolation:
+		return true
+	}
+	return false
+}
+
+// nakDelay returns the redelivery delay after the given number of deliveries,
+// doubling from jetstreamNakBaseDelay up to jetstreamNakMaxDelay.
+func nakDelay(delivered uint64) time.Duration {
+	delay := jetstreamNakBaseDelay
+	for i := uint64(1); i < delivered && delay < jetstreamNakMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, jetstreamNakMaxDelay)
+}
+
+// stopConsumers stops the JetStream consumers, letting the messages being
+// handled finish.
+func stopConsumers() {
+	for _, consumeContext := range consumeContexts {
+		consumeContext.Drain()
+	}
+	for _, consumeContext := range consumeContexts {
+		<-consumeContext.Closed()
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestHandleJetStreamMsg tests the handleJetStreamMsg function
+func TestHandleJetStreamMsg(t *testing.T) {
+	tests := []struct {
+		name       string
+		handlerErr error
+		delivered  uint64
+		setupMocks func(*MockJetStreamMsg)
+	}{
+		{
+			name:      "success is acknowledged",
+			delivered: 1,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("Ack").Return(nil).Once()
+			},
+		},
+		{
+			name:       "upstream error is redelivered with a backoff",
+			handlerErr: newHandlerError(errCodeUpstream, errors.New("write failed")),
+			delivered:  3,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("NakWithDelay", 4*time.Second).Return(nil).Once()
+			},
+		},
+		{
+			name:       "unclassified error is redelivered",
+			handlerErr: errors.New("failed"),
+			delivered:  1,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("NakWithDelay", time.Second).Return(nil).Once()
+			},
+		},
+		{
+			name:       "invalid payload is terminated",
+			handlerErr: newHandlerError(errCodeInvalidPayload, errors.New("bad JSON")),
+			delivered:  1,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("TermWithReason", errCodeInvalidPayload).Return(nil).Once()
+			},
+		},
+		{
+			name:       "schema violation is terminated",
+			handlerErr: newHandlerError(errCodeSchemaViolation, errors.New("unknown relation")),
+			delivered:  2,
+			setupMocks: func(msg *MockJetStreamMsg) {
+				msg.On("TermWithReason", errCodeSchemaViolation).Return(nil).Once()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewMockJetStreamMsg("lfx.update_access.project", []byte(`{"uid":"123"}`), tt.delivered)
+			tt.setupMocks(msg)
+
+			var handled INatsMsg
+			handleJetStreamMsg(msg, "project update access", func(_ context.Context, message INatsMsg) error {
+				handled = message
+				return tt.handlerErr
+			})
+
+			// Stream messages are never answered on their ack subject.
+			assert.Equal(t, "", handled.Reply())
+			assert.Equal(t, []byte(`{"uid":"123"}`), handled.Data())
+			msg.AssertExpectations(t)
+		})
+	}
+}
+
+// TestKeepInProgress tests that a message waiting for a worker is reported in
+// progress until it is handled, and once more when it is.
+func TestKeepInProgress(t *testing.T) {
+	savedInterval := jetstreamProgressInterval
+	defer func() { jetstreamProgressInterval = savedInterval }()
+	jetstreamProgressInterval = 5 * time.Millisecond
+
+	msg := NewMockJetStreamMsg("lfx.update_access.project", []byte(`{"uid":"123"}`), 1)
+	var reported atomic.Int32
+	msg.On("InProgress").Run(func(mock.Arguments) { reported.Add(1) }).Return(nil)
+
+	handling := keepInProgress(msg)
+	assert.Eventually(t, func() bool {
+		return reported.Load() >= 2
+	}, time.Second, time.Millisecond)
+	handling()
+
+	// No more progress is reported once the message is handled.
+	calls := reported.Load()
+	time.Sleep(4 * jetstreamProgressInterval)
+	assert.Equal(t, calls, reported.Load())
+}
+
+// TestNakDelay tests the nakDelay function
+func TestNakDelay(t *testing.T) {
+	assert.Equal(t, time.Second, nakDelay(0))
+	assert.Equal(t, time.Second, nakDelay(1))
+	assert.Equal(t, 2*time.Second, nakDelay(2))
+	assert.Equal(t, 64*time.Second, nakDelay(7))
+	assert.Equal(t, 2*time.Minute, nakDelay(8))
+	assert.Equal(t, 2*time.Minute, nakDelay(100))
+}
+
+// TestJetStreamSubjects tests the isSyncSubject and consumerName functions
+func TestJetStreamSubjects(t *testing.T) {
+	assert.True(t, isSyncSubject("lfx.update_access.project"))
+	assert.True(t, isSyncSubject("lfx.put_registrant.meeting"))
+	assert.False(t, isSyncSubject("lfx.access_check.request"))
+	assert.False(t, isSyncSubject("lfx.update_access_dryrun.project"))
+	assert.False(t, isSyncSubject("lfx.delete_all_access_dryrun.project"))
+
+	assert.Equal(t, "fga-sync_lfx_update_access_project", consumerName("lfx.update_access.project"))
+	assert.Equal(t, "fga-sync_lfx_add_relation_all", consumerName("lfx.add_relation.*"))
+}
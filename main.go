@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -83,9 +84,41 @@ func main() {
 		logOptions.AddSource = true
 	}
 
-	logger = slog.New(slog.NewJSONHandler(os.Stdout, logOptions))
+	// Log lines written while handling a message carry its subject and request
+	// headers.
+	logger = slog.New(contextHandler{slog.NewJSONHandler(os.Stdout, logOptions)})
 	slog.SetDefault(logger)
 
+	if err := loadCascadeConfig(); err != nil {
+		logger.With(errKey, err).Error("invalid delete cascade configuration")
+		os.Exit(1)
+	}
+
+	if err := loadObjectTypes(); err != nil {
+		logger.With(errKey, err).Error("invalid object types configuration")
+		os.Exit(1)
+	}
+
+	if err := loadRetryConfig(); err != nil {
+		logger.With(errKey, err).Error("invalid OpenFGA retry configuration")
+		os.Exit(1)
+	}
+
+	if err := loadBreakerConfig(); err != nil {
+		logger.With(errKey, err).Error("invalid OpenFGA circuit breaker configuration")
+		os.Exit(1)
+	}
+
+	if err := loadWorkerConfig(); err != nil {
+		logger.With(errKey, err).Error("invalid worker pool configuration")
+		os.Exit(1)
+	}
+
+	if err := loadTimeoutConfig(); err != nil {
+		logger.With(errKey, err).Error("invalid handler timeout configuration")
+		os.Exit(1)
+	}
+
 	// Create an OpenFGA client.
 	fgaClient, err := connectFga()
 	if err != nil {
@@ -95,6 +128,16 @@ func main() {
 
 	logger.With("url", os.Getenv("OPENFGA_API_URL")).Info("OpenFGA client created")
 
+	// Load the authorization model used to validate update payloads.
+	authzModel, err = FgaService{client: fgaClient}.ReadAuthorizationModel(context.Background())
+	if err != nil {
+		logger.With(errKey, err, "model_id", os.Getenv("OPENFGA_AUTH_MODEL_ID")).
+			Error("error reading OpenFGA authorization model")
+		os.Exit(1)
+	}
+	logger.With("model_id", os.Getenv("OPENFGA_AUTH_MODEL_ID"), "types", len(authzModel)).
+		Info("OpenFGA authorization model loaded")
+
 	// Create HTTP handlers for health checks.
 	createHTTPHandlers()
 
@@ -126,7 +169,9 @@ func main() {
 			logger.With("url", nc.ConnectedUrl()).Info("NATS reconnected")
 		}),
 		nats.ErrorHandler(func(_ *nats.Conn, s *nats.Subscription, err error) {
-			if s != nil {
+			if s != nil && errors.Is(err, nats.ErrSlowConsumer) {
+				handleSlowConsumer(s, err)
+			} else if s != nil {
 				logger.With(errKey, err, "subject", s.Subject, "queue", s.Queue).Error("async NATS error")
 			} else {
 				logger.With(errKey, err).Error("async NATS error outside subscription")
@@ -172,13 +217,37 @@ func main() {
 		return
 	}
 
+	deadLetters, err = createDeadLetterQueue(context.Background())
+	if err != nil {
+		return
+	}
+
+	accessEvents, err := createAccessEventPublisher(context.Background())
+	if err != nil {
+		return
+	}
+
+	// Without JetStream, updates that fail while OpenFGA is unavailable are
+	// dead-lettered, and replayed once it is available again. With JetStream,
+	// they are kept in the stream instead.
+	if !useJetStream {
+		fgaBreaker.onClose = func() {
+			go deadLetters.replayUnavailable(handlersCtx)
+		}
+	}
+
 	handlerService := HandlerService{
 		fgaService: FgaService{
 			client:      fgaClient,
 			cacheBucket: cacheBucket,
+			events:      accessEvents,
 		},
 	}
 
+	// Publish the access changes left in the outbox by failed publications or
+	// by a previous run.
+	go handlerService.fgaService.relayAccessChanges(handlersCtx)
+
 	if err = createQueueSubscriptions(handlerService); err != nil {
 		logger.With(errKey, err).Error("error creating queue subscriptions")
 		return
@@ -190,6 +259,23 @@ func main() {
 	// Cancel the background context.
 	cancel()
 
+	// The messages being handled have handlerShutdownTimeout to finish, after
+	// which their OpenFGA calls are canceled.
+	cancelTimer := time.AfterFunc(handlerShutdownTimeout, func() {
+		logger.Warn("canceling the messages still being handled")
+		cancelHandlers()
+	})
+
+	// Stop the JetStream consumers, so that the messages being handled are
+	// acknowledged before the connection is drained.
+	stopConsumers()
+
+	// Drain the core NATS subscriptions and wait for the queued messages to be
+	// handled, so that their replies are sent before the connection is drained.
+	stopWorkers()
+	cancelTimer.Stop()
+	cancelHandlers()
+
 	// Drain the connection, which will drain all subscriptions, then close the
 	// connection when complete.
 	if !natsConn.IsClosed() && !natsConn.IsDraining() {
@@ -257,6 +343,16 @@ func createHTTPHandlers() {
 			http.Error(w, "NATS connection not ready", http.StatusServiceUnavailable)
 			return
 		}
+		// The service keeps running while OpenFGA is unavailable, answering
+		// checks from the cache and keeping updates for later, so it stays
+		// ready but reports the degraded state.
+		if state := fgaBreaker.State(); state != circuitClosed {
+			_, err := fmt.Fprintf(w, "DEGRADED: OpenFGA circuit breaker %s\n", state)
+			if err != nil {
+				logger.With(errKey, err).Error("error writing to response writer")
+			}
+			return
+		}
 		_, err := fmt.Fprintf(w, "OK\n")
 		if err != nil {
 			logger.With(errKey, err).Error("error writing to response writer")
@@ -265,7 +361,7 @@ func createHTTPHandlers() {
 }
 
 // HandlerFunc defines a message handler function type.
-type HandlerFunc func(INatsMsg) error
+type HandlerFunc func(context.Context, INatsMsg) error
 
 // subscriptionConfig defines a NATS subscription configuration.
 type subscriptionConfig struct {
@@ -274,17 +370,36 @@ type subscriptionConfig struct {
 	description string
 }
 
-// subscribeToSubject subscribes to a single NATS subject with error handling and logging.
+// subscribeToSubject subscribes to a single NATS subject with error handling
+// and logging. Messages are handled by the worker pool of the subject.
 func subscribeToSubject(subject, description, queue string, handler HandlerFunc) error {
-	if _, err := natsConn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
-		if errHandler := handler(&NatsMsg{msg}); errHandler != nil {
-			logger.Error("error handling "+description+" request",
+	pool := addWorkerPool(subject)
+	sub, err := natsConn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		receivedAt := time.Now()
+		accepted := pool.submit(msg.Data, func() {
+			message := &NatsMsg{msg}
+			ctx, cancel := handlerContext(message, receivedAt)
+			defer cancel()
+			errHandler := handler(ctx, message)
+			if errHandler == nil {
+				return
+			}
+			logger.ErrorContext(ctx, "error handling "+description+" request",
 				errKey, errHandler,
-				"subject", subject,
 				"queue", queue,
 			)
+			// Core NATS messages are not redelivered, so every failed update is
+			// dead-lettered, unless it was a dry run, which writes nothing.
+			if isSyncSubject(msg.Subject) && !isDryRun(message) {
+				//nolint:errcheck // the error is logged by add
+				deadLetters.add(context.Background(), msg.Subject, msg.Data, msg.Header, errHandler, 1, receivedAt)
+			}
+		})
+		if !accepted {
+			rejectOverloaded(&NatsMsg{msg})
 		}
-	}); err != nil {
+	})
+	if err != nil {
 		logger.Error("error subscribing to NATS subject",
 			errKey, err,
 			"subject", subject,
@@ -292,9 +407,12 @@ func subscribeToSubject(subject, description, queue string, handler HandlerFunc)
 		)
 		return err
 	}
+	natsSubscriptions = append(natsSubscriptions, sub)
 	logger.Info("subscribed to NATS subject",
 		"subject", subject,
 		"queue", queue,
+		"workers", subjectLimits(subject).workers,
+		"queue_depth", subjectLimits(subject).queueDepth,
 	)
 	return nil
 }
@@ -341,32 +459,133 @@ func createQueueSubscriptions(handlerService HandlerService) error {
 			description: "meeting registrant remove",
 		},
 		{
-			subject:     constants.CommitteeUpdateAccessSubject,
-			handler:     handlerService.committeeUpdateAccessHandler,
-			description: "committee update access",
+			subject:     constants.MeetingRegistrantsSyncSubject,
+			handler:     handlerService.meetingRegistrantsSyncHandler,
+			description: "meeting registrants sync",
+		},
+		{
+			subject:     constants.TeamMemberPutSubject,
+			handler:     handlerService.teamMemberPutHandler,
+			description: "team member put",
 		},
 		{
-			subject:     constants.CommitteeDeleteAllAccessSubject,
-			handler:     handlerService.committeeDeleteAllAccessHandler,
-			description: "committee delete all access",
+			subject:     constants.TeamMemberRemoveSubject,
+			handler:     handlerService.teamMemberRemoveHandler,
+			description: "team member remove",
 		},
 		{
-			subject:     constants.GroupsIOServiceUpdateAccessSubject,
-			handler:     handlerService.groupsIOServiceUpdateAccessHandler,
-			description: "groups.io service update access",
+			subject:     constants.CommitteeMemberPutSubject,
+			handler:     handlerService.committeeMemberPutHandler,
+			description: "committee member put",
 		},
 		{
-			subject:     constants.GroupsIOServiceDeleteAllAccessSubject,
-			handler:     handlerService.groupsIOServiceDeleteAllAccessHandler,
-			description: "groups.io service delete all access",
+			subject:     constants.CommitteeMemberRemoveSubject,
+			handler:     handlerService.committeeMemberRemoveHandler,
+			description: "committee member remove",
 		},
+		{
+			subject:     constants.GroupsIOMailingListMemberPutSubject,
+			handler:     handlerService.mailingListMemberPutHandler,
+			description: "groups.io mailing list member put",
+		},
+		{
+			subject:     constants.GroupsIOMailingListMemberRemoveSubject,
+			handler:     handlerService.mailingListMemberRemoveHandler,
+			description: "groups.io mailing list member remove",
+		},
+		{
+			subject:     constants.AddRelationSubject,
+			handler:     handlerService.addRelationHandler,
+			description: "add relation",
+		},
+		{
+			subject:     constants.RemoveRelationSubject,
+			handler:     handlerService.removeRelationHandler,
+			description: "remove relation",
+		},
+	}
+
+	// Registered object types are served by the generic handlers, unless they
+	// have a dedicated handler.
+	subscribed := make(map[string]bool, len(subscriptions))
+	for _, config := range subscriptions {
+		subscribed[config.subject] = true
+	}
+	for _, objType := range objectTypes {
+		if subscribed[constants.UpdateAccessSubjectPrefix+objType.Type] {
+			continue
+		}
+		subscriptions = append(subscriptions,
+			subscriptionConfig{
+				subject:     constants.UpdateAccessSubjectPrefix + objType.Type,
+				handler:     handlerService.updateAccessHandler(objType.Type),
+				description: objType.Type + " update access",
+			},
+			subscriptionConfig{
+				subject:     constants.DeleteAllAccessSubjectPrefix + objType.Type,
+				handler:     handlerService.deleteAllAccessHandler(objType.Type),
+				description: objType.Type + " delete all access",
+			},
+		)
+	}
+
+	// The dead-letter admin subjects are request/reply only. They are not
+	// authorized by the service: NATS permissions must restrict who may
+	// publish to them, as they expose payloads and replay updates.
+	if deadLetters != nil {
+		subscriptions = append(subscriptions,
+			subscriptionConfig{
+				subject:     constants.DeadLetterListSubject,
+				handler:     deadLetters.listHandler,
+				description: "dead letter list",
+			},
+			subscriptionConfig{
+				subject:     constants.DeadLetterGetSubject,
+				handler:     deadLetters.getHandler,
+				description: "dead letter get",
+			},
+			subscriptionConfig{
+				subject:     constants.DeadLetterReplaySubject,
+				handler:     deadLetters.replayHandler,
+				description: "dead letter replay",
+			},
+		)
+	}
+
+	// With JetStream, update and delete subjects are consumed from a stream so
+	// that messages published while no replica is running are not lost.
+	var stream jetstream.Stream
+	if useJetStream {
+		var streamSubjects []string
+		for _, config := range subscriptions {
+			if isSyncSubject(config.subject) {
+				streamSubjects = append(streamSubjects, config.subject)
+			}
+		}
+		var err error
+		if stream, err = createSyncStream(context.Background(), streamSubjects); err != nil {
+			return err
+		}
 	}
 
 	// Subscribe to each subject using the helper function
 	for _, config := range subscriptions {
-		if err := subscribeToSubject(config.subject, config.description, queue, config.handler); err != nil {
+		if stream != nil && isSyncSubject(config.subject) {
+			err := consumeSubject(context.Background(), stream, config.subject, config.description, config.handler)
+			if err != nil {
+				return err
+			}
+		} else if err := subscribeToSubject(config.subject, config.description, queue, config.handler); err != nil {
 			return err
 		}
+
+		// Update and delete subjects also get a dry-run variant served by the
+		// same handler.
+		if dryRun := dryRunSubject(config.subject); dryRun != "" {
+			if err := subscribeToSubject(dryRun, config.description+" dry run", queue, config.handler); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
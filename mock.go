@@ -5,9 +5,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
+	nats "github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	openfga "github.com/openfga/go-sdk"
 	"github.com/stretchr/testify/mock"
@@ -51,12 +55,20 @@ func (m *MockFgaClient) BatchCheck(
 	return args.Get(0).(*openfga.BatchCheckResponse), args.Error(1)
 }
 
+// ReadAuthorizationModel implements the IFgaClient interface
+func (m *MockFgaClient) ReadAuthorizationModel(ctx context.Context) (*ClientReadAuthorizationModelResponse, error) {
+	args := m.Called(ctx)
+	//nolint:errcheck // the error is passed through to the caller
+	return args.Get(0).(*ClientReadAuthorizationModelResponse), args.Error(1)
+}
+
 // MockNatsMsg is a mock implementation of the INatsMsg interface
 type MockNatsMsg struct {
 	mock.Mock
 	reply   string
 	data    []byte
 	subject string
+	header  nats.Header
 }
 
 // Reply implements the INatsMsg interface
@@ -80,6 +92,11 @@ func (m *MockNatsMsg) Subject() string {
 	return m.subject
 }
 
+// Header implements the INatsMsg interface
+func (m *MockNatsMsg) Header() nats.Header {
+	return m.header
+}
+
 // CreateMockNatsMsg creates a mock NATS message that can be used in tests
 func CreateMockNatsMsg(data []byte) *MockNatsMsg {
 	msg := MockNatsMsg{
@@ -94,6 +111,8 @@ type MockKeyValue struct {
 	mu           sync.Mutex
 	data         map[string][]byte
 	createdTimes map[string]time.Time
+	revisions    map[string]uint64
+	lastRevision uint64
 	returnError  error
 	notFoundKeys map[string]bool
 }
@@ -103,6 +122,7 @@ func NewMockKeyValue() *MockKeyValue {
 	return &MockKeyValue{
 		data:         make(map[string][]byte),
 		createdTimes: make(map[string]time.Time),
+		revisions:    make(map[string]uint64),
 		notFoundKeys: make(map[string]bool),
 	}
 }
@@ -120,9 +140,10 @@ func (m *MockKeyValue) Get(ctx context.Context, key string) (jetstream.KeyValueE
 	}
 	if data, exists := m.data[key]; exists {
 		return &MockKeyValueEntry{
-			key:     key,
-			value:   data,
-			created: m.createdTimes[key],
+			key:      key,
+			value:    data,
+			created:  m.createdTimes[key],
+			revision: m.revisions[key],
 		}, nil
 	}
 	return nil, jetstream.ErrKeyNotFound
@@ -136,11 +157,101 @@ func (m *MockKeyValue) Put(ctx context.Context, key string, value []byte) (uint6
 	if m.returnError != nil {
 		return 0, m.returnError
 	}
+	return m.put(key, value), nil
+}
+
+// put stores a value and returns its revision.
+func (m *MockKeyValue) put(key string, value []byte) uint64 {
+	m.lastRevision++
 	m.data[key] = value
 	m.createdTimes[key] = time.Now()
-	return 1, nil
+	m.revisions[key] = m.lastRevision
+	return m.lastRevision
+}
+
+// Create implements the jetstream.KeyValue interface
+func (m *MockKeyValue) Create(
+	ctx context.Context,
+	key string,
+	value []byte,
+	_ ...jetstream.KVCreateOpt,
+) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.returnError != nil {
+		return 0, m.returnError
+	}
+	if _, exists := m.data[key]; exists {
+		return 0, jetstream.ErrKeyExists
+	}
+	return m.put(key, value), nil
+}
+
+// Update implements the jetstream.KeyValue interface
+func (m *MockKeyValue) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.returnError != nil {
+		return 0, m.returnError
+	}
+	if m.revisions[key] != revision {
+		return 0, errors.New("wrong last sequence")
+	}
+	return m.put(key, value), nil
+}
+
+// Delete implements the jetstream.KeyValue interface
+func (m *MockKeyValue) Delete(ctx context.Context, key string, _ ...jetstream.KVDeleteOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.returnError != nil {
+		return m.returnError
+	}
+	delete(m.data, key)
+	delete(m.createdTimes, key)
+	delete(m.revisions, key)
+	return nil
+}
+
+// ListKeys implements the jetstream.KeyValue interface
+func (m *MockKeyValue) ListKeys(ctx context.Context, _ ...jetstream.WatchOpt) (jetstream.KeyLister, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.returnError != nil {
+		return nil, m.returnError
+	}
+	keys := make(chan string, len(m.data))
+	for key := range m.data {
+		keys <- key
+	}
+	close(keys)
+	return mockKeyLister(keys), nil
+}
+
+// Keys returns the keys of the mock bucket
+func (m *MockKeyValue) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.data))
+}
+
+// SetCreated sets when the value of a key was stored
+func (m *MockKeyValue) SetCreated(key string, created time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createdTimes[key] = created
 }
 
+// mockKeyLister is a mock implementation of jetstream.KeyLister
+type mockKeyLister chan string
+
+func (l mockKeyLister) Keys() <-chan string { return l }
+func (l mockKeyLister) Stop() error         { return nil }
+
 // PutString implements the jetstream.KeyValue interface
 func (m *MockKeyValue) PutString(ctx context.Context, key, value string) (uint64, error) {
 	return m.Put(ctx, key, []byte(value))
@@ -175,3 +286,114 @@ func (m *MockKeyValueEntry) Created() time.Time              { return m.created
 func (m *MockKeyValueEntry) Revision() uint64                { return m.revision }
 func (m *MockKeyValueEntry) Delta() uint64                   { return 0 }
 func (m *MockKeyValueEntry) Operation() jetstream.KeyValueOp { return jetstream.KeyValuePut }
+
+// MockJetStreamMsg is a mock implementation of the jetstream.Msg interface
+type MockJetStreamMsg struct {
+	mock.Mock
+	data      []byte
+	subject   string
+	delivered uint64
+}
+
+// NewMockJetStreamMsg creates a JetStream message mock delivered the given number of times
+func NewMockJetStreamMsg(subject string, data []byte, delivered uint64) *MockJetStreamMsg {
+	return &MockJetStreamMsg{data: data, subject: subject, delivered: delivered}
+}
+
+// Metadata implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+// Data implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Data() []byte {
+	return m.data
+}
+
+// Headers implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Headers() nats.Header {
+	return nil
+}
+
+// Subject implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Subject() string {
+	return m.subject
+}
+
+// Reply implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Reply() string {
+	return "$JS.ACK." + m.subject
+}
+
+// Ack implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Ack() error {
+	return m.Called().Error(0)
+}
+
+// DoubleAck implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) DoubleAck(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+// Nak implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Nak() error {
+	return m.Called().Error(0)
+}
+
+// NakWithDelay implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) NakWithDelay(delay time.Duration) error {
+	return m.Called(delay).Error(0)
+}
+
+// InProgress implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) InProgress() error {
+	return m.Called().Error(0)
+}
+
+// Term implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) Term() error {
+	return m.Called().Error(0)
+}
+
+// TermWithReason implements the jetstream.Msg interface
+func (m *MockJetStreamMsg) TermWithReason(reason string) error {
+	return m.Called(reason).Error(0)
+}
+
+// MockDeadLetterStream is a mock implementation of the IDeadLetterStream interface
+type MockDeadLetterStream struct {
+	mock.Mock
+}
+
+// GetMsg implements the IDeadLetterStream interface
+func (m *MockDeadLetterStream) GetMsg(
+	ctx context.Context,
+	seq uint64,
+	opts ...jetstream.GetMsgOpt,
+) (*jetstream.RawStreamMsg, error) {
+	args := m.Called(ctx, seq, len(opts) > 0)
+	//nolint:errcheck // the error is passed through to the caller
+	return args.Get(0).(*jetstream.RawStreamMsg), args.Error(1)
+}
+
+// DeleteMsg implements the IDeadLetterStream interface
+func (m *MockDeadLetterStream) DeleteMsg(ctx context.Context, seq uint64) error {
+	return m.Called(ctx, seq).Error(0)
+}
+
+// MockJetStreamPublisher is a mock implementation of the IJetStreamPublisher interface
+type MockJetStreamPublisher struct {
+	mock.Mock
+}
+
+// Publish implements the IJetStreamPublisher interface
+func (m *MockJetStreamPublisher) Publish(
+	ctx context.Context,
+	subject string,
+	payload []byte,
+	_ ...jetstream.PublishOpt,
+) (*jetstream.PubAck, error) {
+	args := m.Called(ctx, subject, payload)
+	//nolint:errcheck // the error is passed through to the caller
+	return args.Get(0).(*jetstream.PubAck), args.Error(1)
+}
@@ -23,16 +23,23 @@ const (
 	RelationHost        = "host"
 	RelationParticipant = "participant"
 
-	// Team relations
-	RelationMember = "member"
+	// Team and committee relations
+	RelationMember   = "member"
+	RelationChair    = "chair"
+	RelationObserver = "observer"
+
+	// Mailing list relations
+	RelationSubscriber = "subscriber"
+	RelationModerator  = "moderator"
 
 	// Object type prefixes
-	ObjectTypeUser            = "user:"
-	ObjectTypeProject         = "project:"
-	ObjectTypeCommittee       = "committee:"
-	ObjectTypeTeam            = "team:"
-	ObjectTypeMeeting         = "meeting:"
-	ObjectTypeGroupsIOService = "groupsio_service:"
+	ObjectTypeUser                = "user:"
+	ObjectTypeProject             = "project:"
+	ObjectTypeCommittee           = "committee:"
+	ObjectTypeTeam                = "team:"
+	ObjectTypeMeeting             = "meeting:"
+	ObjectTypeGroupsIOService     = "groupsio_service:"
+	ObjectTypeGroupsIOMailingList = "groupsio_mailing_list:"
 
 	// Special user identifiers
 	UserWildcard = "user:*" // Public access (all users)
@@ -9,6 +9,31 @@ const (
 	KVBucketNameSyncCache = "fga-sync-cache"
 )
 
+// NATS JetStream names.
+const (
+	// SyncStreamName is the default name of the JetStream stream of the update and delete subjects.
+	SyncStreamName = "fga-sync"
+
+	// FgaSyncConsumerPrefix is the prefix of the durable consumer names, followed by the subject
+	// with dots replaced by underscores.
+	FgaSyncConsumerPrefix = "fga-sync_"
+
+	// DeadLetterStreamName is the default name of the JetStream stream of the messages that failed.
+	DeadLetterStreamName = "fga-sync-dead-letter"
+
+	// DeadLetterAppliedBucketName is the default name of the KV bucket of when the updates that
+	// supersede dead letters were applied.
+	DeadLetterAppliedBucketName = "fga-sync-dead-letter-applied"
+
+	// AccessChangedStreamName is the default name of the JetStream stream of the access change
+	// events.
+	AccessChangedStreamName = "fga-sync-access-changed"
+
+	// AccessOutboxBucketName is the default name of the KV bucket of the access changes waiting
+	// to be published.
+	AccessOutboxBucketName = "fga-sync-access-outbox"
+)
+
 // NATS wildcard subjects that the FGA sync service handles messages about.
 const (
 	// AccessCheckSubject is the subject for the access check request.
@@ -39,21 +64,111 @@ const (
 	// The subject is of the form: lfx.remove_registrant.meeting
 	MeetingRegistrantRemoveSubject = "lfx.remove_registrant.meeting"
 
-	// CommitteeUpdateAccessSubject is the subject for the committee access control updates.
-	// The subject is of the form: lfx.update_access.committee
-	CommitteeUpdateAccessSubject = "lfx.update_access.committee"
+	// MeetingRegistrantsSyncSubject is the subject for replacing the registrants of a meeting
+	// with a full list.
+	// The subject is of the form: lfx.sync_registrants.meeting
+	MeetingRegistrantsSyncSubject = "lfx.sync_registrants.meeting"
+
+	// TeamMemberPutSubject is the subject for adding team members.
+	// The subject is of the form: lfx.put_member.team
+	TeamMemberPutSubject = "lfx.put_member.team"
+
+	// TeamMemberRemoveSubject is the subject for removing team members.
+	// The subject is of the form: lfx.remove_member.team
+	TeamMemberRemoveSubject = "lfx.remove_member.team"
+
+	// CommitteeMemberPutSubject is the subject for adding committee members or changing their role.
+	// The subject is of the form: lfx.put_member.committee
+	CommitteeMemberPutSubject = "lfx.put_member.committee"
+
+	// CommitteeMemberRemoveSubject is the subject for removing committee members.
+	// The subject is of the form: lfx.remove_member.committee
+	CommitteeMemberRemoveSubject = "lfx.remove_member.committee"
+
+	// GroupsIOMailingListMemberPutSubject is the subject for adding groups.io mailing list members.
+	// The subject is of the form: lfx.put_member.groupsio_mailing_list
+	GroupsIOMailingListMemberPutSubject = "lfx.put_member.groupsio_mailing_list"
+
+	// GroupsIOMailingListMemberRemoveSubject is the subject for removing groups.io mailing list members.
+	// The subject is of the form: lfx.remove_member.groupsio_mailing_list
+	GroupsIOMailingListMemberRemoveSubject = "lfx.remove_member.groupsio_mailing_list"
+
+	// AddRelationSubject is the wildcard subject for adding relations to an object of any type,
+	// without replacing its other relations.
+	// The subject is of the form: lfx.add_relation.<object_type>
+	AddRelationSubject = AddRelationSubjectPrefix + "*"
+
+	// RemoveRelationSubject is the wildcard subject for removing relations from an object of any type,
+	// without replacing its other relations.
+	// The subject is of the form: lfx.remove_relation.<object_type>
+	RemoveRelationSubject = RemoveRelationSubjectPrefix + "*"
+)
+
+// NATS subject prefixes for the subjects that are handled for any object type.
+// A dry-run request runs the normal update or delete handler and computes the
+// tuple diff, but does not write to OpenFGA or the cache.
+const (
+	// UpdateAccessSubjectPrefix is the prefix of the access control update subjects.
+	// The subject is of the form: lfx.update_access.<object_type>
+	UpdateAccessSubjectPrefix = "lfx.update_access."
+
+	// DeleteAllAccessSubjectPrefix is the prefix of the access control deletion subjects.
+	// The subject is of the form: lfx.delete_all_access.<object_type>
+	DeleteAllAccessSubjectPrefix = "lfx.delete_all_access."
+
+	// UpdateAccessDryRunSubjectPrefix is the prefix of the dry-run access control update subjects.
+	// The subject is of the form: lfx.update_access_dryrun.<object_type>
+	UpdateAccessDryRunSubjectPrefix = "lfx.update_access_dryrun."
 
-	// CommitteeDeleteAllAccessSubject is the subject for the committee access control deletion.
-	// The subject is of the form: lfx.delete_all_access.committee
-	CommitteeDeleteAllAccessSubject = "lfx.delete_all_access.committee"
+	// DeleteAllAccessDryRunSubjectPrefix is the prefix of the dry-run access control deletion subjects.
+	// The subject is of the form: lfx.delete_all_access_dryrun.<object_type>
+	DeleteAllAccessDryRunSubjectPrefix = "lfx.delete_all_access_dryrun."
 
-	// GroupsIOServiceUpdateAccessSubject is the subject for the groups.io service access control updates.
-	// The subject is of the form: lfx.update_access.groupsio_service
-	GroupsIOServiceUpdateAccessSubject = "lfx.update_access.groupsio_service"
+	// AddRelationSubjectPrefix is the prefix of the relation add subjects.
+	// The subject is of the form: lfx.add_relation.<object_type>
+	AddRelationSubjectPrefix = "lfx.add_relation."
 
-	// GroupsIOServiceDeleteAllAccessSubject is the subject for the groups.io service access control deletion.
-	// The subject is of the form: lfx.delete_all_access.groupsio_service
-	GroupsIOServiceDeleteAllAccessSubject = "lfx.delete_all_access.groupsio_service"
+	// RemoveRelationSubjectPrefix is the prefix of the relation removal subjects.
+	// The subject is of the form: lfx.remove_relation.<object_type>
+	RemoveRelationSubjectPrefix = "lfx.remove_relation."
+)
+
+// NATS subjects of the access change events published by the FGA sync service.
+const (
+	// AccessChangedSubjects matches every access change event subject.
+	AccessChangedSubjects = "lfx.access_changed.>"
+
+	// AccessChangedObjectSubjectPrefix is the prefix of the subjects of the access change events
+	// of an object, followed by its object type.
+	// The subject is of the form: lfx.access_changed.object.<object_type>
+	AccessChangedObjectSubjectPrefix = "lfx.access_changed.object."
+
+	// AccessChangedUserSubjectPrefix is the prefix of the subjects of the access changes of a user,
+	// followed by the user ID.
+	// The subject is of the form: lfx.access_changed.user.<user_id>
+	AccessChangedUserSubjectPrefix = "lfx.access_changed.user."
+)
+
+// NATS subjects of the dead-letter queue.
+const (
+	// DeadLetterSubject is the subject the messages that failed are published to.
+	// The subject is of the form: lfx.fga-sync.dead_letter
+	DeadLetterSubject = "lfx.fga-sync.dead_letter"
+
+	// DeadLetterAdminSubjectPrefix is the prefix of the dead-letter admin subjects.
+	DeadLetterAdminSubjectPrefix = "lfx.fga-sync.dead_letter."
+
+	// DeadLetterListSubject is the subject for listing the dead letters.
+	// The subject is of the form: lfx.fga-sync.dead_letter.list
+	DeadLetterListSubject = DeadLetterAdminSubjectPrefix + "list"
+
+	// DeadLetterGetSubject is the subject for getting a dead letter with its payload.
+	// The subject is of the form: lfx.fga-sync.dead_letter.get
+	DeadLetterGetSubject = DeadLetterAdminSubjectPrefix + "get"
+
+	// DeadLetterReplaySubject is the subject for replaying a dead letter to its original subject.
+	// The subject is of the form: lfx.fga-sync.dead_letter.replay
+	DeadLetterReplaySubject = DeadLetterAdminSubjectPrefix + "replay"
 )
 
 // NATS queue subjects that the FGA sync service handles messages about.
@@ -62,3 +177,30 @@ const (
 	// The subject is of the form: lfx.fga-sync.queue
 	FgaSyncQueue = "lfx.fga-sync.queue"
 )
+
+// NATS message headers read by the FGA sync service. They are matched case-insensitively.
+const (
+	// RequestTimeoutHeader is the header of a request carrying how long the caller waits for the
+	// reply, as a duration such as "2s" or "500ms".
+	RequestTimeoutHeader = "Request-Timeout"
+
+	// RequestIDHeader is the header identifying a request, echoed in its reply and logged.
+	RequestIDHeader = "Request-Id"
+
+	// TenantIDHeader is the header of the tenant a message is about, which is logged.
+	TenantIDHeader = "Tenant-Id"
+
+	// ContentTypeHeader is the header of the media type of a message payload, which is logged.
+	ContentTypeHeader = "Content-Type"
+
+	// DryRunHeader is the header asking for an update or delete to be handled as a dry run when
+	// set to "true", like the dry-run subjects.
+	DryRunHeader = "Dry-Run"
+
+	// TraceparentHeader is the W3C trace context header, echoed in replies and whose trace ID is
+	// logged.
+	TraceparentHeader = "traceparent"
+
+	// TracestateHeader is the W3C trace context vendor state header, echoed in replies.
+	TracestateHeader = "tracestate"
+)
@@ -0,0 +1,280 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	nats "github.com/nats-io/nats.go"
+)
+
+// poolLimits are the concurrency limits of the worker pool of a subject.
+type poolLimits struct {
+	// workers is the number of messages of the subject handled concurrently.
+	workers int
+	// queueDepth is the number of received messages of the subject waiting for
+	// a worker.
+	queueDepth int
+}
+
+var (
+	// checkLimits are the limits of the request/reply subjects: access checks,
+	// dry runs and the dead-letter admin subjects.
+	checkLimits = poolLimits{workers: 16, queueDepth: 256}
+	// updateLimits are the limits of the update and delete subjects.
+	updateLimits = poolLimits{workers: 4, queueDepth: 64}
+
+	// workerPools are the worker pools of the subscribed subjects, stopped on
+	// shutdown.
+	workerPools   []*workerPool
+	workerPoolsMu sync.Mutex
+	// natsSubscriptions are the core NATS subscriptions, drained on shutdown.
+	natsSubscriptions []*nats.Subscription
+
+	// workerRejected counts the requests rejected with a full queue by subject.
+	workerRejected *expvar.Map
+	// slowConsumers counts the slow consumer events of core NATS subscriptions
+	// by subject. Messages are dropped by the NATS client on each event.
+	slowConsumers *expvar.Map
+)
+
+func init() {
+	workerRejected = expvar.NewMap("worker_rejected")
+	slowConsumers = expvar.NewMap("slow_consumer_events")
+	expvar.Publish("worker_queued", expvar.Func(func() any {
+		workerPoolsMu.Lock()
+		defer workerPoolsMu.Unlock()
+		queued := make(map[string]int, len(workerPools))
+		for _, pool := range workerPools {
+			queued[pool.subject] = pool.queued()
+		}
+		return queued
+	}))
+}
+
+// loadWorkerConfig loads the worker pool limits of the check and update
+// subjects from the environment.
+func loadWorkerConfig() error {
+	for name, target := range map[string]*int{
+		"CHECK_WORKERS":      &checkLimits.workers,
+		"CHECK_QUEUE_DEPTH":  &checkLimits.queueDepth,
+		"UPDATE_WORKERS":     &updateLimits.workers,
+		"UPDATE_QUEUE_DEPTH": &updateLimits.queueDepth,
+	} {
+		setting := os.Getenv(name)
+		if setting == "" {
+			continue
+		}
+		value, err := strconv.Atoi(setting)
+		// Workers must be positive, while a queue depth of zero hands each
+		// message directly to an idle worker.
+		if err != nil || value < 0 || (value == 0 && (name == "CHECK_WORKERS" || name == "UPDATE_WORKERS")) {
+			return fmt.Errorf("invalid %s %q", name, setting)
+		}
+		*target = value
+	}
+	return nil
+}
+
+// subjectLimits returns the worker pool limits of a subject.
+func subjectLimits(subject string) poolLimits {
+	if isSyncSubject(subject) {
+		return updateLimits
+	}
+	return checkLimits
+}
+
+// workerPool handles the messages of a subject concurrently, with a bounded
+// queue of messages waiting for a worker.
+//
+// Ordered pools are used for the update and delete subjects: each worker has
+// its own queue, and the messages of an object always go to the same worker so
+// that they are applied in the order they were received. When the queue is
+// full, submitting waits, which stops reading from the subscription and lets
+// the messages back up in NATS.
+//
+// Unordered pools are used for request/reply subjects: the workers share a
+// queue, and a message submitted while it is full is rejected so that the
+// caller can be told to retry instead of waiting past its request timeout.
+type workerPool struct {
+	subject string
+	ordered bool
+	queues  []chan func()
+	wg      sync.WaitGroup
+}
+
+// newWorkerPool creates a worker pool and starts its workers.
+func newWorkerPool(subject string, limits poolLimits, ordered bool) *workerPool {
+	pool := &workerPool{subject: subject, ordered: ordered}
+	if ordered {
+		depth := limits.queueDepth / limits.workers
+		for range limits.workers {
+			pool.queues = append(pool.queues, make(chan func(), depth))
+		}
+	} else {
+		pool.queues = []chan func(){make(chan func(), limits.queueDepth)}
+	}
+
+	for i := range limits.workers {
+		queue := pool.queues[i%len(pool.queues)]
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return pool
+}
+
+// submit queues a job handling the message data. It returns false if the pool
+// is unordered and its queue is full.
+func (p *workerPool) submit(data []byte, job func()) bool {
+	if !p.ordered {
+		select {
+		case p.queues[0] <- job:
+			return true
+		default:
+			workerRejected.Add(p.subject, 1)
+			return false
+		}
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(objectKey(data)))
+	p.queues[hash.Sum32()%uint32(len(p.queues))] <- job
+	return true
+}
+
+// queued returns the number of jobs waiting for a worker.
+func (p *workerPool) queued() int {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return queued
+}
+
+// stop waits for the queued jobs to be handled and stops the workers. Nothing
+// may be submitted afterwards.
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// objectKey returns the key that orders the messages of an update or delete
+// subject: the UID of the object it changes. Delete messages are the bare UID,
+// and bulk messages are ordered by their first entry.
+func objectKey(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var entries []json.RawMessage
+		if json.Unmarshal(data, &entries) == nil && len(entries) > 0 {
+			data = entries[0]
+		}
+	}
+	if len(data) > 0 && data[0] == '{' {
+		var stub struct {
+			UID            string `json:"uid"`
+			MeetingUID     string `json:"meeting_uid"`
+			TeamUID        string `json:"team_uid"`
+			CommitteeUID   string `json:"committee_uid"`
+			MailingListUID string `json:"mailing_list_uid"`
+		}
+		if json.Unmarshal(data, &stub) == nil {
+			for _, uid := range []string{stub.UID, stub.MeetingUID, stub.TeamUID, stub.CommitteeUID, stub.MailingListUID} {
+				if uid != "" {
+					return uid
+				}
+			}
+		}
+	}
+	return string(data)
+}
+
+// addWorkerPool creates the worker pool of a subject with the limits of its
+// type.
+func addWorkerPool(subject string) *workerPool {
+	pool := newWorkerPool(subject, subjectLimits(subject), isSyncSubject(subject))
+	workerPoolsMu.Lock()
+	workerPools = append(workerPools, pool)
+	workerPoolsMu.Unlock()
+	return pool
+}
+
+// rejectOverloaded answers a request that was rejected because the worker pool
+// of its subject is full.
+func rejectOverloaded(msg INatsMsg) {
+	logger.With("subject", msg.Subject()).Warn("worker queue full; rejecting request")
+	if msg.Reply() == "" {
+		return
+	}
+
+	// Access checks are answered with plain text, and the other requests with
+	// a structured error.
+	reply := []byte("service overloaded")
+	if msg.Subject() != constants.AccessCheckSubject {
+		reply, _ = json.Marshal(struct {
+			Error replyError `json:"error"`
+		}{replyError{Code: errCodeOverloaded, Message: "service overloaded, retry later"}})
+	}
+	if err := msg.Respond(reply); err != nil {
+		logger.With(errKey, err, "subject", msg.Subject()).Warn("failed to send reply")
+	}
+}
+
+// handleSlowConsumer records that the NATS client dropped messages of a
+// subscription because its pending buffer was full. Dropped updates are not
+// dead-lettered: they never reached the service.
+func handleSlowConsumer(sub *nats.Subscription, err error) {
+	slowConsumers.Add(sub.Subject, 1)
+	pending, _, _ := sub.Pending()
+	dropped, _ := sub.Dropped()
+	logger.With(
+		errKey, err,
+		"subject", sub.Subject,
+		"queue", sub.Queue,
+		"pending", pending,
+		"dropped", dropped,
+	).Error("NATS slow consumer: messages were dropped")
+}
+
+// stopWorkers drains the core NATS subscriptions, then waits for the queued
+// messages of every subject to be handled. The JetStream consumers must be
+// stopped first.
+func stopWorkers() {
+	for _, sub := range natsSubscriptions {
+		closed := sub.StatusChanged(nats.SubscriptionClosed)
+		if err := sub.Drain(); err != nil {
+			logger.With(errKey, err, "subject", sub.Subject).Warn("error draining NATS subscription")
+			continue
+		}
+		select {
+		case <-closed:
+		case <-time.After(gracefulShutdownSeconds * time.Second):
+			// The subscription may still submit messages, so the pools are
+			// left running.
+			logger.With("subject", sub.Subject).Warn("timed out draining NATS subscription")
+			return
+		}
+	}
+
+	workerPoolsMu.Lock()
+	defer workerPoolsMu.Unlock()
+	for _, pool := range workerPools {
+		pool.stop()
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright The Linux Foundation and each contributor to LFX.
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/linuxfoundation/lfx-v2-fga-sync/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestObjectKey tests the objectKey function
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "update", data: `{"uid":"project-1","public":true}`, want: "project-1"},
+		{name: "delete", data: " project-1\n", want: "project-1"},
+		{name: "registrant", data: `{"username":"user-1","meeting_uid":"meeting-1"}`, want: "meeting-1"},
+		{name: "bulk registrants", data: `[{"username":"user-1","meeting_uid":"meeting-2"}]`, want: "meeting-2"},
+		{name: "team member", data: `{"username":"user-1","team_uid":"team-1"}`, want: "team-1"},
+		{name: "committee member", data: `{"username":"user-1","committee_uid":"committee-1"}`, want: "committee-1"},
+		{name: "mailing list member", data: `{"username":"user-1","mailing_list_uid":"list-1"}`, want: "list-1"},
+		{name: "invalid JSON", data: `{"uid":`, want: `{"uid":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, objectKey([]byte(tt.data)))
+		})
+	}
+}
+
+// TestWorkerPoolOrdered tests that an ordered pool handles the messages of an
+// object in order, and waits for its jobs on stop.
+func TestWorkerPoolOrdered(t *testing.T) {
+	pool := newWorkerPool("lfx.update_access.project", poolLimits{workers: 4, queueDepth: 8}, true)
+
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	for i := range 20 {
+		for _, uid := range []string{"project-1", "project-2", "project-3"} {
+			pool.submit([]byte(uid), func() {
+				mu.Lock()
+				defer mu.Unlock()
+				handled[uid] = append(handled[uid], i)
+			})
+		}
+	}
+	pool.stop()
+
+	for _, uid := range []string{"project-1", "project-2", "project-3"} {
+		assert.Len(t, handled[uid], 20)
+		assert.IsIncreasing(t, handled[uid], uid)
+	}
+}
+
+// TestWorkerPoolUnordered tests that an unordered pool handles jobs
+// concurrently and rejects them once its queue is full.
+func TestWorkerPoolUnordered(t *testing.T) {
+	pool := newWorkerPool(constants.AccessCheckSubject, poolLimits{workers: 2, queueDepth: 1}, false)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocked := func() {
+		started <- struct{}{}
+		<-release
+	}
+	// Both workers are busy at once.
+	assert.True(t, pool.submit(nil, blocked))
+	<-started
+	assert.True(t, pool.submit(nil, blocked))
+	<-started
+
+	assert.True(t, pool.submit(nil, func() {}))
+	assert.Equal(t, 1, pool.queued())
+	assert.False(t, pool.submit(nil, func() {}))
+
+	close(release)
+	pool.stop()
+	assert.Equal(t, 0, pool.queued())
+}
+
+// TestRejectOverloaded tests the replies to rejected requests
+func TestRejectOverloaded(t *testing.T) {
+	check := CreateMockNatsMsg([]byte("project:1#viewer@user:1"))
+	check.subject = constants.AccessCheckSubject
+	check.reply = "inbox"
+	check.On("Respond", []byte("service overloaded")).Return(nil)
+	rejectOverloaded(check)
+	check.AssertExpectations(t)
+
+	dryRun := CreateMockNatsMsg([]byte(`{"uid":"project-1"}`))
+	dryRun.subject = constants.UpdateAccessDryRunSubjectPrefix + "project"
+	dryRun.reply = "inbox"
+	dryRun.On("Respond", errorReply(errCodeOverloaded)).Return(nil)
+	rejectOverloaded(dryRun)
+	dryRun.AssertExpectations(t)
+
+	noReply := CreateMockNatsMsg(nil)
+	noReply.subject = constants.AccessCheckSubject
+	rejectOverloaded(noReply)
+	noReply.AssertNotCalled(t, "Respond", mock.Anything)
+}
+
+// TestLoadWorkerConfig tests the loadWorkerConfig function
+func TestLoadWorkerConfig(t *testing.T) {
+	savedCheck, savedUpdate := checkLimits, updateLimits
+	defer func() { checkLimits, updateLimits = savedCheck, savedUpdate }()
+
+	t.Setenv("CHECK_WORKERS", "32")
+	t.Setenv("UPDATE_WORKERS", "2")
+	t.Setenv("UPDATE_QUEUE_DEPTH", "0")
+	assert.NoError(t, loadWorkerConfig())
+	assert.Equal(t, poolLimits{workers: 32, queueDepth: savedCheck.queueDepth}, checkLimits)
+	assert.Equal(t, poolLimits{workers: 2, queueDepth: 0}, updateLimits)
+	assert.Equal(t, updateLimits, subjectLimits(constants.ProjectUpdateAccessSubject))
+	assert.Equal(t, checkLimits, subjectLimits(constants.AccessCheckSubject))
+
+	t.Setenv("UPDATE_WORKERS", "0")
+	assert.Error(t, loadWorkerConfig())
+
+	t.Setenv("UPDATE_WORKERS", "")
+	t.Setenv("CHECK_QUEUE_DEPTH", "-1")
+	assert.Error(t, loadWorkerConfig())
+}